@@ -1,17 +1,26 @@
 package main
 
 import (
+	"context"
+	"expvar"
 	"net"
-	"os"
+	"net/http"
+	"os/signal"
+	"syscall"
 
 	"go.uber.org/zap"
 
+	"github.com/joshjon/jobrunner/internal/audit"
 	"github.com/joshjon/jobrunner/internal/auth"
 	"github.com/joshjon/jobrunner/internal/config"
 	"github.com/joshjon/jobrunner/internal/server"
+	"github.com/joshjon/jobrunner/pkg/worker"
 )
 
 func main() {
+	// Run as a job init process when re-executed by the worker
+	worker.Init()
+
 	logger, err := zap.NewProduction()
 	if err != nil {
 		panic(err)
@@ -29,27 +38,136 @@ func main() {
 		Port: cfg.Port,
 	}
 
-	tlsConfig, err := auth.SetupTLSConfig(auth.TLSConfig{
+	var auditLog *audit.Logger
+	if cfg.Audit != nil {
+		auditLog, err = audit.Open(cfg.Audit.File, audit.Options{
+			MaxSize:    int64(cfg.Audit.MaxSizeMB) << 20,
+			MaxBackups: cfg.Audit.MaxBackups,
+		})
+		if err != nil {
+			logger.Fatal("error opening audit log", zap.Error(err))
+		}
+		defer auditLog.Close()
+	}
+
+	var tokens *auth.TokenVerifier
+	if cfg.TokenAuth != nil {
+		tokens, err = auth.NewTokenVerifier(auth.TokenConfig{
+			KeyFile:      cfg.TokenAuth.KeyFile,
+			SubjectClaim: cfg.TokenAuth.SubjectClaim,
+			Issuer:       cfg.TokenAuth.Issuer,
+			Audience:     cfg.TokenAuth.Audience,
+		})
+		if err != nil {
+			logger.Fatal("error setting up token auth", zap.Error(err))
+		}
+	}
+
+	serverTLS, err := auth.NewServerTLS(auth.TLSConfig{
 		CertFile:      cfg.Cert.ServerCertFile,
 		KeyFile:       cfg.Cert.ServerKeyFile,
 		CAFile:        cfg.Cert.CAFile,
+		CRLFile:       cfg.Cert.CRLFile,
 		ServerAddress: rpcAddr.IP.String(),
 		Type:          auth.TypeServer,
+		// Clients authenticating with tokens have no certificate
+		ClientCertOptional: tokens != nil,
+		OnRevoked:          auditLog.RevokedCertificate,
 	})
 	if err != nil {
 		logger.Fatal("error setting up tls config", zap.Error(err))
 	}
+	// Rotated certificates are served without restarting
+	unwatchTLS, err := serverTLS.Watch(auditLog.Reload)
+	if err != nil {
+		logger.Fatal("error watching tls files", zap.Error(err))
+	}
+	defer unwatchTLS()
+
+	if cfg.MetricsAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/debug/vars", expvar.Handler())
+		go func() {
+			if err := http.ListenAndServe(cfg.MetricsAddress, mux); err != nil {
+				logger.Error("error serving metrics", zap.Error(err))
+			}
+		}()
+	}
+
+	var workerOpts []worker.Option
+	if auditLog != nil {
+		workerOpts = append(workerOpts, worker.WithEventHandler(auditLog.JobEvent))
+	}
+	if cfg.Retention != nil {
+		workerOpts = append(workerOpts, worker.WithRetention(worker.RetentionPolicy{
+			MaxAge:      cfg.Retention.MaxAge,
+			MaxCount:    cfg.Retention.MaxCount,
+			MaxLogBytes: cfg.Retention.MaxLogSizeMB << 20,
+			Interval:    cfg.Retention.Interval,
+		}))
+	}
+	if cfg.JobStoreFile != "" {
+		store, err := worker.OpenBoltStore(cfg.JobStoreFile)
+		if err != nil {
+			logger.Fatal("error opening job store", zap.Error(err))
+		}
+		defer store.Close()
+		workerOpts = append(workerOpts, worker.WithJobStore(store))
+	}
+	if cfg.CgroupRoot != "" {
+		workerOpts = append(workerOpts, worker.WithCgroupRoot(cfg.CgroupRoot))
+	}
+	if cfg.RunAs != nil {
+		workerOpts = append(workerOpts, worker.WithDefaultCredential(worker.Credential{
+			UID:    cfg.RunAs.UID,
+			GID:    cfg.RunAs.GID,
+			Groups: cfg.RunAs.Groups,
+		}))
+	}
 
+	identity, err := auth.ParseIdentitySource(cfg.Cert.Identity)
+	if err != nil {
+		logger.Fatal("error parsing identity source", zap.Error(err))
+	}
+
+	service, err := server.NewService(server.ServiceConfig{
+		LogDir:            cfg.LogDir,
+		ACLModelFile:      cfg.Cert.ACLModelFile,
+		ACLPolicyFile:     cfg.Cert.ACLPolicyFile,
+		CommandPolicyFile: cfg.Cert.CommandPolicyFile,
+		WorkerOptions:     workerOpts,
+		Audit:             auditLog,
+	})
+	if err != nil {
+		logger.Fatal("error creating service", zap.Error(err))
+	}
 	serverCfg := server.Config{
-		Address: rpcAddr.String(),
-		TLS:     tlsConfig,
-		Service: server.NewService(os.TempDir(), cfg.Cert.ACLModelFile, cfg.Cert.ACLPolicyFile),
+		Address:  rpcAddr.String(),
+		TLS:      serverTLS.Config(),
+		Service:  service,
+		Identity: identity,
+		Tokens:   tokens,
+		Audit:    auditLog,
 	}
 	srv, err := server.New(serverCfg)
 	if err != nil {
 		logger.Fatal("error creating server", zap.Error(err))
 	}
 
+	// Terminate every job on shutdown so none outlive the server. Jobs are
+	// stopped first so that log streams complete and the server can stop
+	// gracefully.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		logger.Info("shutting down")
+		if err := service.Shutdown(); err != nil {
+			logger.Error("error stopping jobs", zap.Error(err))
+		}
+		srv.Stop()
+	}()
+
 	logger.Info("serving on " + srv.Address())
 	if err = srv.Serve(); err != nil {
 		logger.Panic("error serving jobrunner server", zap.Error(err))
@@ -0,0 +1,249 @@
+// Package audit writes an append-only log of RPCs, job lifecycle events and
+// security events of the server as JSON lines.
+package audit
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/joshjon/jobrunner/pkg/worker"
+)
+
+const fileMode = 0600
+
+type Kind string
+
+const (
+	KindRPC         Kind = "rpc"
+	KindJob         Kind = "job"
+	KindCertificate Kind = "certificate"
+	KindReload      Kind = "reload"
+)
+
+type Decision string
+
+const (
+	DecisionAllow Decision = "allow"
+	DecisionDeny  Decision = "deny"
+)
+
+// Event is a line of the audit log. RPC events record who made the call, what
+// it was made on and its outcome; job events record the lifecycle of jobs with
+// the owner as the subject. Certificate events record rejected client
+// certificates, and reload events the reloads of the ACL and TLS files.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Kind    Kind      `json:"kind"`
+	Subject string    `json:"subject,omitempty"`
+	Domain  string    `json:"domain,omitempty"`
+	RPC     string    `json:"rpc,omitempty"`
+	JobID   string    `json:"job_id,omitempty"`
+	// JobIDs are the jobs affected by RPCs acting on several jobs.
+	JobIDs []string `json:"job_ids,omitempty"`
+	Cmd    string   `json:"cmd,omitempty"`
+	Args   []string `json:"args,omitempty"`
+	// Decision is whether the call was authenticated and authorized.
+	Decision Decision `json:"decision,omitempty"`
+	// Outcome is the gRPC status code of the call.
+	Outcome  string `json:"outcome,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Event    string `json:"event,omitempty"`
+	State    string `json:"state,omitempty"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Signal   string `json:"signal,omitempty"`
+	// Serial is the serial number of the certificate of certificate events.
+	Serial string `json:"serial,omitempty"`
+	// Files are the files loaded by reload events.
+	Files []string `json:"files,omitempty"`
+}
+
+// Options control the rotation of the log. The log is not rotated if MaxSize
+// is 0.
+type Options struct {
+	// MaxSize is the size in bytes after which the log is rotated.
+	MaxSize int64
+	// MaxBackups is the number of rotated logs kept, at least 1. The most
+	// recent is the path with the suffix ".1".
+	MaxBackups int
+}
+
+// Logger appends events to an audit log. All methods may be called on a nil
+// Logger, which does not log anything.
+type Logger struct {
+	mu   sync.Mutex
+	path string
+	opts Options
+	file *os.File
+	size int64
+}
+
+// Open opens the audit log at the path, creating it if it does not exist.
+func Open(path string, opts Options) (*Logger, error) {
+	if opts.MaxBackups < 1 {
+		opts.MaxBackups = 1
+	}
+	l := &Logger{path: path, opts: opts}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Log appends the event to the log. Events are logged with the current time if
+// they have none. Errors writing the log are logged but otherwise ignored so
+// that calls do not fail.
+func (l *Logger) Log(event Event) {
+	if l == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		zap.L().Error("error encoding audit event", zap.Error(err))
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.opts.MaxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.opts.MaxSize {
+		if err := l.rotate(); err != nil {
+			zap.L().Error("error rotating audit log", zap.String("path", l.path), zap.Error(err))
+		}
+	}
+	if l.file == nil {
+		return
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		zap.L().Error("error writing audit log", zap.String("path", l.path), zap.Error(err))
+	}
+}
+
+// JobEvent logs the job event. It is a worker event handler.
+func (l *Logger) JobEvent(event worker.JobEvent) {
+	if l == nil {
+		return
+	}
+	job := event.Job
+	e := Event{
+		Kind:    KindJob,
+		Subject: job.Metadata.Owner,
+		Domain:  job.Metadata.Domain,
+		JobID:   job.ID,
+		Cmd:     job.Cmd,
+		Args:    job.Args,
+		Event:   string(event.Type),
+		State:   job.Status.State.String(),
+	}
+	switch event.Type {
+	case worker.JobEventStopping:
+		e.State = event.StopState.String()
+		e.Signal = event.Signal.String()
+	case worker.JobEventCompleted:
+		exitCode := job.Status.ExitCode
+		e.ExitCode = &exitCode
+		if job.Status.Signal != 0 {
+			e.Signal = job.Status.Signal.String()
+		}
+		if job.Status.ExitError != nil {
+			e.Error = job.Status.ExitError.Error()
+		}
+	}
+	l.Log(e)
+}
+
+// RevokedCertificate logs the rejection of a revoked client certificate. It is
+// a TLS revocation handler.
+func (l *Logger) RevokedCertificate(cert *x509.Certificate) {
+	if l == nil {
+		return
+	}
+	l.Log(Event{
+		Kind:     KindCertificate,
+		Subject:  cert.Subject.String(),
+		Event:    "revoked",
+		Decision: DecisionDeny,
+		Serial:   cert.SerialNumber.String(),
+	})
+}
+
+// Reload logs a reload of the named files, which failed if err is not nil. It
+// is a reload handler of watched files.
+func (l *Logger) Reload(name string, files []string, err error) {
+	if l == nil {
+		return
+	}
+	e := Event{Kind: KindReload, Event: name, Files: files}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	l.Log(e)
+}
+
+// Close closes the log.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+func (l *Logger) open() error {
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, fileMode)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file, l.size = file, info.Size()
+	return nil
+}
+
+// rotate renames the log to the first backup, shifting the previous backups
+// and removing the oldest, and opens a new log. The log is reopened even if it
+// could not be renamed, so that events are still written.
+func (l *Logger) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.file = nil
+
+	var err error
+	for i := l.opts.MaxBackups - 1; i > 0 && err == nil; i-- {
+		if err = os.Rename(l.backup(i), l.backup(i+1)); os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	if err == nil {
+		err = os.Rename(l.path, l.backup(1))
+	}
+	if openErr := l.open(); openErr != nil {
+		return openErr
+	}
+	return err
+}
+
+func (l *Logger) backup(i int) string {
+	return fmt.Sprintf("%s.%d", l.path, i)
+}
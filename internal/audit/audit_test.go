@@ -0,0 +1,114 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joshjon/jobrunner/pkg/worker"
+)
+
+func TestLogger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	logger, err := Open(path, Options{})
+	require.NoError(t, err)
+
+	logger.Log(Event{Kind: KindRPC, Subject: "alice", RPC: "/service.v1.Service/Start", Decision: DecisionAllow})
+	logger.JobEvent(worker.JobEvent{
+		Type: worker.JobEventCompleted,
+		Job: worker.JobSummary{
+			ID:       "job-1",
+			Metadata: worker.Metadata{Owner: "alice", Domain: "default"},
+			Cmd:      "sleep",
+			Status:   worker.JobStatus{State: worker.JobStateStopped, ExitCode: -1, Signal: syscall.SIGTERM},
+		},
+	})
+	logger.RevokedCertificate(&x509.Certificate{Subject: pkix.Name{CommonName: "leaked"}, SerialNumber: big.NewInt(42)})
+	logger.Reload("ACL", []string{"model.conf", "policy.csv"}, errors.New("invalid policy"))
+	require.NoError(t, logger.Close())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(fileMode), info.Mode().Perm())
+
+	events := readEvents(t, path)
+	require.Len(t, events, 4)
+	require.Equal(t, "alice", events[0].Subject)
+	require.False(t, events[0].Time.IsZero())
+	require.Equal(t, KindJob, events[1].Kind)
+	require.Equal(t, "job-1", events[1].JobID)
+	require.Equal(t, "completed", events[1].Event)
+	require.Equal(t, "stopped", events[1].State)
+	require.Equal(t, -1, *events[1].ExitCode)
+	require.Equal(t, syscall.SIGTERM.String(), events[1].Signal)
+	require.Equal(t, KindCertificate, events[2].Kind)
+	require.Equal(t, "CN=leaked", events[2].Subject)
+	require.Equal(t, "42", events[2].Serial)
+	require.Equal(t, DecisionDeny, events[2].Decision)
+	require.Equal(t, KindReload, events[3].Kind)
+	require.Equal(t, "ACL", events[3].Event)
+	require.Equal(t, []string{"model.conf", "policy.csv"}, events[3].Files)
+	require.Equal(t, "invalid policy", events[3].Error)
+
+	// Reopening the log appends to it
+	logger, err = Open(path, Options{})
+	require.NoError(t, err)
+	logger.Log(Event{Kind: KindRPC, Subject: "bob"})
+	require.NoError(t, logger.Close())
+	require.Len(t, readEvents(t, path), 5)
+}
+
+func TestLogger_rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	event := Event{Time: time.Now(), Kind: KindRPC, Subject: "alice"}
+	line, err := json.Marshal(event)
+	require.NoError(t, err)
+
+	// Each log holds two events
+	logger, err := Open(path, Options{MaxSize: int64(2 * (len(line) + 1)), MaxBackups: 2})
+	require.NoError(t, err)
+	for i := 0; i < 7; i++ {
+		logger.Log(event)
+	}
+	require.NoError(t, logger.Close())
+
+	require.Len(t, readEvents(t, path), 1)
+	require.Len(t, readEvents(t, path+".1"), 2)
+	require.Len(t, readEvents(t, path+".2"), 2)
+	require.NoFileExists(t, path+".3")
+}
+
+func TestLogger_nil(t *testing.T) {
+	var logger *Logger
+	logger.Log(Event{Kind: KindRPC})
+	logger.JobEvent(worker.JobEvent{Type: worker.JobEventStarted})
+	logger.RevokedCertificate(&x509.Certificate{SerialNumber: big.NewInt(1)})
+	logger.Reload("TLS", nil, nil)
+	require.NoError(t, logger.Close())
+}
+
+func readEvents(t *testing.T, path string) []Event {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+	require.NoError(t, scanner.Err())
+	return events
+}
@@ -0,0 +1,72 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	grpcmiddleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type eventContextKey struct{}
+
+// FromContext returns the event of the RPC being audited, which handlers add
+// the subject and what the call was made on to, or nil if it is not audited.
+func FromContext(ctx context.Context) *Event {
+	event, _ := ctx.Value(eventContextKey{}).(*Event)
+	return event
+}
+
+// Annotate calls annotate with the event of the RPC being audited, if any.
+func Annotate(ctx context.Context, annotate func(*Event)) {
+	if event := FromContext(ctx); event != nil {
+		annotate(event)
+	}
+}
+
+// UnaryServerInterceptor logs an event for every unary call, with the time it
+// was made, once it returns.
+func (l *Logger) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if l == nil {
+			return handler(ctx, req)
+		}
+		event := &Event{Time: time.Now(), Kind: KindRPC, RPC: info.FullMethod}
+		resp, err := handler(context.WithValue(ctx, eventContextKey{}, event), req)
+		l.logRPC(event, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor logs an event for every streaming call once it
+// returns.
+func (l *Logger) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if l == nil {
+			return handler(srv, stream)
+		}
+		event := &Event{Time: time.Now(), Kind: KindRPC, RPC: info.FullMethod}
+		wrapped := grpcmiddleware.WrapServerStream(stream)
+		wrapped.WrappedContext = context.WithValue(stream.Context(), eventContextKey{}, event)
+		err := handler(srv, wrapped)
+		l.logRPC(event, err)
+		return err
+	}
+}
+
+func (l *Logger) logRPC(event *Event, err error) {
+	st := status.Convert(err)
+	event.Outcome = st.Code().String()
+	event.Decision = DecisionAllow
+	switch st.Code() {
+	case codes.OK:
+	case codes.Unauthenticated, codes.PermissionDenied:
+		event.Decision = DecisionDeny
+		fallthrough
+	default:
+		event.Error = st.Message()
+	}
+	l.Log(*event)
+}
@@ -2,28 +2,157 @@ package auth
 
 import (
 	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/casbin/casbin"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+const (
+	// DomainWildcard is the domain of roles and policies that apply in every
+	// domain.
+	DomainWildcard = "*"
+	// OwnerRole is the role every subject has for the jobs it owns.
+	OwnerRole = "owner"
+)
+
 func New(model, policy string) *Authorizer {
 	enforcer := casbin.NewEnforcer(model, policy)
+	addFunctions(enforcer)
 	return &Authorizer{
+		model:    model,
+		policy:   policy,
 		enforcer: enforcer,
 	}
 }
 
 type Authorizer struct {
+	model  string
+	policy string
+
+	mu       sync.RWMutex
 	enforcer *casbin.Enforcer
 }
 
-func (a *Authorizer) Authorize(subject, object, action string) error {
-	if !a.enforcer.Enforce(subject, object, action) {
+// Policy permits subjects with a role (or the subject itself) to perform the
+// action on the object in the domain.
+type Policy struct {
+	Role   string
+	Domain string
+	Object string
+	Action string
+}
+
+// Permissions are the roles of a subject in a domain, including inherited
+// roles, and the policies that apply to it.
+type Permissions struct {
+	Roles    []string
+	Policies []Policy
+}
+
+func (a *Authorizer) Authorize(subject, domain, object, action string) error {
+	if !a.getEnforcer().Enforce(subject, domain, object, action) {
 		msg := fmt.Sprintf("%s not permitted to %s on %s", subject, action, object)
 		st := status.New(codes.PermissionDenied, msg)
 		return st.Err()
 	}
 	return nil
 }
+
+// Permissions returns the effective permissions of the subject in the domain.
+func (a *Authorizer) Permissions(subject, domain string) Permissions {
+	enforcer := a.getEnforcer()
+	roles := map[string]bool{}
+	for _, d := range []string{domain, DomainWildcard} {
+		for _, role := range enforcer.GetImplicitRolesForUser(subject, d) {
+			roles[role] = true
+		}
+	}
+
+	var perms Permissions
+	for role := range roles {
+		perms.Roles = append(perms.Roles, role)
+	}
+	sort.Strings(perms.Roles)
+
+	// Policies for the owner apply to every subject on the jobs it owns
+	roles[subject] = true
+	roles[OwnerRole] = true
+
+	for _, rule := range enforcer.GetPolicy() {
+		if len(rule) < 4 || !roles[rule[0]] || (rule[1] != domain && rule[1] != DomainWildcard) {
+			continue
+		}
+		perms.Policies = append(perms.Policies, Policy{
+			Role:   rule[0],
+			Domain: rule[1],
+			Object: rule[2],
+			Action: rule[3],
+		})
+	}
+
+	return perms
+}
+
+// Reload loads the model and policy files again, keeping the current ACL if
+// they are invalid.
+func (a *Authorizer) Reload() error {
+	enforcer, err := casbin.NewEnforcerSafe(a.model, a.policy)
+	if err != nil {
+		return fmt.Errorf("error loading ACL: %w", err)
+	}
+	addFunctions(enforcer)
+	// Casbin only evaluates the matcher and checks the policies against the
+	// model when enforcing
+	if _, err := enforcer.EnforceSafe("", "", "", ""); err != nil {
+		return fmt.Errorf("error loading ACL: %w", err)
+	}
+
+	a.mu.Lock()
+	a.enforcer = enforcer
+	a.mu.Unlock()
+	return nil
+}
+
+// Watch reloads the ACL whenever the model or policy file changes until the
+// returned function is called. The result of each reload is passed to
+// onReload if it is not nil.
+func (a *Authorizer) Watch(onReload ReloadHandler) (func(), error) {
+	return watchFiles("ACL", []string{a.model, a.policy}, a.Reload, onReload)
+}
+
+// JobObject is the object policies identify the job with the ID started by the
+// owner by, in the form jobs/<owner>/<job id>. The owner is escaped so that
+// owners containing "/" or "*" cannot match the jobs of other owners.
+func JobObject(owner string, jobID string) string {
+	return "jobs/" + url.PathEscape(owner) + "/" + jobID
+}
+
+// ownerMatch reports whether the object is a job, or all jobs, owned by
+// exactly the subject.
+func ownerMatch(object string, subject string) bool {
+	parts := strings.Split(object, "/")
+	return len(parts) == 3 && parts[0] == "jobs" && parts[1] == url.PathEscape(subject) && parts[2] != ""
+}
+
+// addFunctions adds the functions models may use in their matchers.
+func addFunctions(enforcer *casbin.Enforcer) {
+	enforcer.AddFunction("ownerMatch", func(args ...interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("ownerMatch takes 2 arguments, got %d", len(args))
+		}
+		object, _ := args[0].(string)
+		subject, _ := args[1].(string)
+		return ownerMatch(object, subject), nil
+	})
+}
+
+func (a *Authorizer) getEnforcer() *casbin.Enforcer {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.enforcer
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const modelFile = "../../config/cert/model.conf"
+
+func TestAuthorizer_owner(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.csv")
+	require.NoError(t, os.WriteFile(policyFile, []byte("p, owner, *, jobs/*, read\n"), 0600))
+	authorizer := New(modelFile, policyFile)
+
+	tests := []struct {
+		name    string
+		subject string
+		object  string
+		want    bool
+	}{
+		{name: "own job", subject: "alice", object: JobObject("alice", "1"), want: true},
+		{name: "all own jobs", subject: "alice", object: JobObject("alice", "*"), want: true},
+		{name: "job of other owner", subject: "alice", object: JobObject("bob", "1")},
+		{name: "owner with path", subject: "alice", object: JobObject("alice/bob", "1")},
+		{name: "owner with wildcard", subject: "alice", object: JobObject("alice*", "*")},
+		{name: "unescaped owner with path", subject: "alice", object: "jobs/alice/bob/1"},
+		{name: "subject with path", subject: "alice/bob", object: JobObject("alice/bob", "1"), want: true},
+		{name: "subject with path prefix", subject: "alice", object: "jobs/alice%2Fbob/1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := authorizer.Authorize(tt.subject, "default", tt.object, "read")
+			require.Equal(t, tt.want, err == nil, err)
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v2"
+)
+
+// matchAll is the path pattern that matches any command, and the argument
+// pattern that matches any remaining arguments.
+const matchAll = "**"
+
+// CommandRule permits, or denies, the subjects and roles it applies to running
+// the commands it matches.
+type CommandRule struct {
+	Name string `yaml:"Name"`
+	// Subjects are the subjects and roles the rule applies to.
+	Subjects []string `yaml:"Subjects"`
+	// Domain is the domain the rule applies in, every domain if empty or "*".
+	Domain string `yaml:"Domain"`
+	// Path is a glob pattern (see path.Match) matched against the command as
+	// requested. Absolute patterns only match absolute commands, which should
+	// be preferred as a bare name is resolved using the PATH of the job. "**"
+	// matches any command.
+	Path string `yaml:"Path"`
+	// Args are glob patterns matched against the arguments by position. A
+	// final "**" matches any remaining arguments. Commands with arguments do
+	// not match a rule without patterns.
+	Args []string `yaml:"Args"`
+	// Env are glob patterns matched against the names of the environment
+	// variables the command sets, each of which must match one of them. "**"
+	// matches any variable. Commands that set variables do not match a rule
+	// without patterns, as variables such as LD_PRELOAD and PATH change what
+	// the command runs.
+	Env []string `yaml:"Env"`
+	// RootFS are glob patterns matched against the root filesystem the
+	// command runs in, if any. "**" matches any root filesystem. Commands run
+	// in a root filesystem do not match a rule without patterns, as the
+	// matched path may then be any executable the subject could write there.
+	RootFS []string `yaml:"RootFS"`
+	// BindMounts are glob patterns matched against the host paths bind
+	// mounted into the root filesystem, each of which must match one of them.
+	// "**" matches any path. Commands with bind mounts do not match a rule
+	// without patterns.
+	BindMounts []string `yaml:"BindMounts"`
+	// Deny denies running the matched commands instead of permitting it.
+	Deny bool `yaml:"Deny"`
+}
+
+// Command is a command to authorize against a CommandPolicy.
+type Command struct {
+	Cmd  string
+	Args []string
+	// Env are the environment variables the command sets, in the form
+	// key=value.
+	Env []string
+	// RootFS is the root filesystem the command runs in, empty for the host.
+	RootFS string
+	// BindMounts are the host paths bind mounted into the root filesystem.
+	BindMounts []string
+}
+
+// CommandPolicy restricts the commands subjects may run. The first rule that
+// applies to a subject and matches the command decides whether the command
+// is permitted, and commands no rule permits are denied.
+type CommandPolicy struct {
+	Rules []CommandRule `yaml:"Rules"`
+}
+
+// LoadCommandPolicy reads a YAML command policy file.
+func LoadCommandPolicy(file string) (*CommandPolicy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var policy CommandPolicy
+	if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+		return nil, fmt.Errorf("error parsing command policy %s: %w", file, err)
+	}
+	if err := policy.validate(); err != nil {
+		return nil, fmt.Errorf("invalid command policy %s: %w", file, err)
+	}
+	return &policy, nil
+}
+
+func (p *CommandPolicy) validate() error {
+	names := map[string]bool{}
+	for i, rule := range p.Rules {
+		switch {
+		case rule.Name == "":
+			return fmt.Errorf("rule %d has no name", i+1)
+		case names[rule.Name]:
+			return fmt.Errorf("duplicate rule %q", rule.Name)
+		case len(rule.Subjects) == 0:
+			return fmt.Errorf("rule %q has no subjects", rule.Name)
+		case rule.Path == "":
+			return fmt.Errorf("rule %q has no path", rule.Name)
+		}
+		names[rule.Name] = true
+
+		patterns := append([]string{rule.Path}, rule.Args...)
+		patterns = append(append(append(patterns, rule.Env...), rule.RootFS...), rule.BindMounts...)
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %q has malformed pattern %q", rule.Name, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// Authorize returns a PermissionDenied error naming the rules that rejected
+// the command if the subject, with the roles in the domain, may not run it
+// with its arguments, environment variables and filesystem.
+func (p *CommandPolicy) Authorize(subject string, roles []string, domain string, command Command) error {
+	cmd := command.Cmd
+	var applied, pathMatched []string
+	for _, rule := range p.Rules {
+		if !rule.appliesTo(subject, roles, domain) {
+			continue
+		}
+		applied = append(applied, rule.Name)
+
+		if !rule.matchPath(cmd) {
+			continue
+		}
+		pathMatched = append(pathMatched, rule.Name)
+
+		if !rule.matchArgs(command.Args) || !rule.matchEnv(command.Env) ||
+			!rule.matchRootFS(command.RootFS) || !rule.matchBindMounts(command.BindMounts) {
+			continue
+		}
+		if rule.Deny {
+			return commandDenied(subject, cmd, fmt.Sprintf("denied by command rule %q", rule.Name))
+		}
+		return nil
+	}
+
+	switch {
+	case len(pathMatched) > 0:
+		return commandDenied(subject, cmd, "arguments, environment or filesystem not permitted by command "+ruleNames(pathMatched))
+	case len(applied) > 0:
+		return commandDenied(subject, cmd, "command not permitted by command "+ruleNames(applied))
+	default:
+		return commandDenied(subject, cmd, "no command rules apply")
+	}
+}
+
+func (r CommandRule) appliesTo(subject string, roles []string, domain string) bool {
+	if r.Domain != "" && r.Domain != DomainWildcard && r.Domain != domain {
+		return false
+	}
+	for _, s := range r.Subjects {
+		if s == subject {
+			return true
+		}
+		for _, role := range roles {
+			if s == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r CommandRule) matchPath(cmd string) bool {
+	if r.Path == matchAll {
+		return true
+	}
+	if path.IsAbs(r.Path) != path.IsAbs(cmd) {
+		return false
+	}
+	ok, _ := path.Match(r.Path, cmd)
+	return ok
+}
+
+func (r CommandRule) matchArgs(args []string) bool {
+	for i, pattern := range r.Args {
+		if pattern == matchAll && i == len(r.Args)-1 {
+			return true
+		}
+		if i >= len(args) {
+			return false
+		}
+		if ok, _ := path.Match(pattern, args[i]); !ok {
+			return false
+		}
+	}
+	return len(args) == len(r.Args)
+}
+
+func (r CommandRule) matchEnv(env []string) bool {
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		if !matchAny(r.Env, name) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r CommandRule) matchRootFS(rootfs string) bool {
+	if rootfs == "" {
+		return true
+	}
+	return matchAny(r.RootFS, rootfs)
+}
+
+func (r CommandRule) matchBindMounts(sources []string) bool {
+	for _, source := range sources {
+		if !matchAny(r.BindMounts, source) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAny reports whether the path matches one of the patterns.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok || pattern == matchAll {
+			return true
+		}
+	}
+	return false
+}
+
+func commandDenied(subject string, cmd string, reason string) error {
+	msg := fmt.Sprintf("%s not permitted to run %s: %s", subject, cmd, reason)
+	return status.New(codes.PermissionDenied, msg).Err()
+}
+
+func ruleNames(names []string) string {
+	if len(names) == 1 {
+		return fmt.Sprintf("rule %q", names[0])
+	}
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = fmt.Sprintf("%q", name)
+	}
+	return "rules " + strings.Join(quoted, ", ")
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const commandsFile = "../../config/cert/commands.yaml"
+
+func TestLoadCommandPolicy(t *testing.T) {
+	_, err := LoadCommandPolicy(commandsFile)
+	require.NoError(t, err)
+
+	for name, commands := range map[string]string{
+		"unknown field":         "Rules:\n  - Name: a\n    Subjects: [root]\n    Path: /bin/echo\n    Arguments: []\n",
+		"missing name":          "Rules:\n  - Subjects: [root]\n    Path: /bin/echo\n",
+		"missing subjects":      "Rules:\n  - Name: a\n    Path: /bin/echo\n",
+		"malformed pattern":     "Rules:\n  - Name: a\n    Subjects: [root]\n    Path: /bin/[\n",
+		"malformed env pattern": "Rules:\n  - Name: a\n    Subjects: [root]\n    Path: /bin/echo\n    Env: [\"LC_[\"]\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			commandsFile := filepath.Join(t.TempDir(), "commands.yaml")
+			require.NoError(t, os.WriteFile(commandsFile, []byte(commands), 0600))
+			_, err := LoadCommandPolicy(commandsFile)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestCommandPolicy_Authorize(t *testing.T) {
+	policy, err := LoadCommandPolicy(commandsFile)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		roles      []string
+		cmd        string
+		args       []string
+		env        []string
+		rootfs     string
+		bindMounts []string
+		want       bool
+	}{
+		{name: "permitted command", roles: []string{"operator"}, cmd: "/usr/bin/du", args: []string{"-sh", "/var"}, want: true},
+		{name: "permitted variable", roles: []string{"operator"}, cmd: "/bin/ls", env: []string{"LC_ALL=C"}, want: true},
+		{name: "shell", roles: []string{"operator"}, cmd: "/bin/sh", args: []string{"-c", "id"}},
+		{name: "shell under /usr/bin", roles: []string{"operator"}, cmd: "/usr/bin/bash", args: []string{"-c", "id"}},
+		{name: "env", roles: []string{"operator"}, cmd: "/usr/bin/env", args: []string{"sh", "-c", "id"}},
+		{name: "preloaded library", roles: []string{"operator"}, cmd: "/bin/ls", env: []string{"LD_PRELOAD=/tmp/evil.so"}},
+		{name: "path", roles: []string{"operator"}, cmd: "/bin/ls", env: []string{"PATH=/tmp"}},
+		{name: "admin shell", roles: []string{"admin"}, cmd: "/bin/sh", args: []string{"-c", "id"}, env: []string{"PATH=/tmp"}, want: true},
+		// A shell copied to a permitted path of a root filesystem
+		{name: "root filesystem", roles: []string{"operator"}, cmd: "/bin/ls", args: []string{"-c", "id"}, rootfs: "/tmp/rootfs"},
+		{name: "bind mounts", roles: []string{"operator"}, cmd: "/bin/ls", bindMounts: []string{"/usr"}},
+		{name: "admin root filesystem", roles: []string{"admin"}, cmd: "/bin/sh", rootfs: "/tmp/rootfs", bindMounts: []string{"/usr"}, want: true},
+		{name: "no roles", cmd: "/bin/ls"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Authorize("alice", tt.roles, "default", Command{
+				Cmd:        tt.cmd,
+				Args:       tt.args,
+				Env:        tt.env,
+				RootFS:     tt.rootfs,
+				BindMounts: tt.bindMounts,
+			})
+			if tt.want {
+				require.NoError(t, err)
+				return
+			}
+			require.Equal(t, codes.PermissionDenied, status.Code(err))
+		})
+	}
+}
+
+func TestCommandPolicy_AuthorizeFilesystem(t *testing.T) {
+	policy := &CommandPolicy{Rules: []CommandRule{
+		{Name: "images", Subjects: []string{"alice"}, Path: "/bin/*", Args: []string{"**"}, RootFS: []string{"/srv/images/*"}, BindMounts: []string{"/srv/data/*"}},
+		{Name: "host", Subjects: []string{"alice"}, Path: "/bin/*", Args: []string{"**"}},
+	}}
+
+	tests := []struct {
+		name    string
+		command Command
+		want    bool
+	}{
+		{name: "host", command: Command{Cmd: "/bin/ls"}, want: true},
+		{name: "permitted root filesystem", command: Command{Cmd: "/bin/ls", RootFS: "/srv/images/alpine"}, want: true},
+		{name: "permitted bind mount", command: Command{Cmd: "/bin/ls", RootFS: "/srv/images/alpine", BindMounts: []string{"/srv/data/a"}}, want: true},
+		{name: "root filesystem", command: Command{Cmd: "/bin/ls", RootFS: "/tmp/rootfs"}},
+		{name: "bind mount", command: Command{Cmd: "/bin/ls", RootFS: "/srv/images/alpine", BindMounts: []string{"/srv/data/a", "/etc"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Authorize("alice", nil, "default", tt.command)
+			if tt.want {
+				require.NoError(t, err)
+				return
+			}
+			require.Equal(t, codes.PermissionDenied, status.Code(err))
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// revocationList is the set of revoked certificates, identified by their
+// issuer and serial number.
+type revocationList struct {
+	revoked map[string]bool
+	// onRevoked is called with rejected certificates if it is not nil.
+	onRevoked func(cert *x509.Certificate)
+}
+
+// loadCRL loads a PEM or DER encoded CRL, or the base64 encoded DER that
+// cfssl gencrl writes, which must be signed by one of the PEM encoded CAs.
+func loadCRL(file string, caPEM []byte) (*revocationList, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(data); block != nil && block.Type == "X509 CRL" {
+		data = block.Bytes
+	} else if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data))); err == nil {
+		data = decoded
+	}
+
+	crl, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CRL %q: %w", file, err)
+	}
+	if !signedByCA(crl, caPEM) {
+		return nil, fmt.Errorf("CRL %q is not signed by a CA", file)
+	}
+	if !crl.NextUpdate.IsZero() && crl.NextUpdate.Before(time.Now()) {
+		// Revocations are still enforced, but newer ones may be missing
+		zap.L().Warn("CRL has expired", zap.String("file", file), zap.Time("next_update", crl.NextUpdate))
+	}
+
+	revoked := &revocationList{revoked: map[string]bool{}}
+	for _, cert := range crl.RevokedCertificates {
+		revoked.revoked[revocationKey(crl.Issuer, cert.SerialNumber.String())] = true
+	}
+	return revoked, nil
+}
+
+func signedByCA(crl *x509.RevocationList, caPEM []byte) bool {
+	for block, rest := pem.Decode(caPEM); block != nil; block, rest = pem.Decode(rest) {
+		ca, err := x509.ParseCertificate(block.Bytes)
+		if err == nil && crl.CheckSignatureFrom(ca) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func revocationKey(issuer pkix.Name, serial string) string {
+	return issuer.String() + "/" + serial
+}
+
+// verifyPeerCertificate rejects verified chains with revoked certificates.
+// Only new connections are verified, so connections established before a
+// certificate was revoked stay open until they are closed.
+func (r *revocationList) verifyPeerCertificate(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+	for _, chain := range verifiedChains {
+		for _, cert := range chain {
+			serial := cert.SerialNumber.String()
+			if r.revoked[revocationKey(cert.Issuer, serial)] {
+				zap.L().Warn("rejected revoked certificate",
+					zap.String("subject", cert.Subject.String()),
+					zap.String("serial", serial),
+				)
+				if r.onRevoked != nil {
+					r.onRevoked(cert)
+				}
+				return fmt.Errorf("certificate %s is revoked", serial)
+			}
+		}
+	}
+	return nil
+}
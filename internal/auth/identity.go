@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// IdentitySource is the field of client certificates that identifies clients.
+type IdentitySource string
+
+const (
+	// IdentityCommonName identifies clients by the subject common name.
+	IdentityCommonName IdentitySource = "cn"
+	// IdentityDNS identifies clients by their first DNS SAN.
+	IdentityDNS IdentitySource = "dns"
+	// IdentityEmail identifies clients by their first email SAN.
+	IdentityEmail IdentitySource = "email"
+	// IdentitySPIFFE identifies clients by their SPIFFE ID, the URI SAN with
+	// the spiffe scheme, of which there must be exactly one.
+	IdentitySPIFFE IdentitySource = "spiffe"
+)
+
+var ErrorNoIdentity = errors.New("certificate has no identity")
+
+// ParseIdentitySource parses an identity source, which defaults to the common
+// name if empty.
+func ParseIdentitySource(source string) (IdentitySource, error) {
+	switch s := IdentitySource(source); s {
+	case "":
+		return IdentityCommonName, nil
+	case IdentityCommonName, IdentityDNS, IdentityEmail, IdentitySPIFFE:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown identity source %q", source)
+}
+
+// Identity returns the identity of the certificate from the source, or the
+// common name if the source is empty.
+func Identity(cert *x509.Certificate, source IdentitySource) (string, error) {
+	var identity string
+	switch source {
+	case "", IdentityCommonName:
+		identity = cert.Subject.CommonName
+	case IdentityDNS:
+		if len(cert.DNSNames) > 0 {
+			identity = cert.DNSNames[0]
+		}
+	case IdentityEmail:
+		if len(cert.EmailAddresses) > 0 {
+			identity = cert.EmailAddresses[0]
+		}
+	case IdentitySPIFFE:
+		for _, uri := range cert.URIs {
+			if uri.Scheme != "spiffe" {
+				continue
+			}
+			if identity != "" {
+				return "", fmt.Errorf("%w: multiple SPIFFE IDs", ErrorNoIdentity)
+			}
+			identity = uri.String()
+		}
+	default:
+		return "", fmt.Errorf("unknown identity source %q", source)
+	}
+
+	if identity == "" {
+		return "", fmt.Errorf("%w: no %s identity", ErrorNoIdentity, source)
+	}
+	return identity, nil
+}
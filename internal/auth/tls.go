@@ -3,8 +3,12 @@ package auth
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"expvar"
 	"fmt"
 	"io/ioutil"
+	"sync"
+
+	"go.uber.org/zap"
 )
 
 type Type int
@@ -16,11 +20,19 @@ const (
 )
 
 type TLSConfig struct {
-	CertFile      string
-	KeyFile       string
-	CAFile        string
-	ServerAddress string
-	Type          Type
+	CertFile string
+	KeyFile  string
+	CAFile   string
+	// CRLFile lists the revoked client certificates of a server, which are
+	// rejected during the handshake. None are revoked if it is empty.
+	CRLFile string
+	// OnRevoked is called with each revoked certificate a server rejects.
+	OnRevoked func(cert *x509.Certificate)
+	// ClientCertOptional lets clients connect to a server without a
+	// certificate, so they must authenticate otherwise.
+	ClientCertOptional bool
+	ServerAddress      string
+	Type               Type
 }
 
 func SetupTLSConfig(cfg TLSConfig) (*tls.Config, error) {
@@ -48,6 +60,17 @@ func SetupTLSConfig(cfg TLSConfig) (*tls.Config, error) {
 	if cfg.Type == TypeServer {
 		tlsConfig.ClientCAs = ca
 		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		if cfg.ClientCertOptional {
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+		if cfg.CRLFile != "" {
+			revoked, err := loadCRL(cfg.CRLFile, bytes)
+			if err != nil {
+				return nil, err
+			}
+			revoked.onRevoked = cfg.OnRevoked
+			tlsConfig.VerifyPeerCertificate = revoked.verifyPeerCertificate
+		}
 	} else if cfg.Type == TypeClient {
 		tlsConfig.RootCAs = ca
 	} else {
@@ -56,3 +79,80 @@ func SetupTLSConfig(cfg TLSConfig) (*tls.Config, error) {
 
 	return tlsConfig, nil
 }
+
+// certificateExpiry is the expiry of the served certificate in seconds since
+// the Unix epoch.
+var certificateExpiry = expvar.NewInt("tls_certificate_expiry_seconds")
+
+// ServerTLS is a server TLS config whose certificate and client CAs are
+// reloaded from their files, so certificates can be rotated without
+// restarting the server. Established connections are not affected, including
+// those of client certificates revoked since they were established.
+type ServerTLS struct {
+	cfg TLSConfig
+
+	mu     sync.RWMutex
+	config *tls.Config
+}
+
+func NewServerTLS(cfg TLSConfig) (*ServerTLS, error) {
+	cfg.Type = TypeServer
+	s := &ServerTLS{cfg: cfg}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Config returns a TLS config that serves the most recently loaded
+// certificate and verifies clients with the most recently loaded CAs.
+func (s *ServerTLS) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			s.mu.RLock()
+			defer s.mu.RUnlock()
+			return s.config, nil
+		},
+	}
+}
+
+// Reload loads the certificate, key and CA files again, keeping the current
+// config if they are invalid.
+func (s *ServerTLS) Reload() error {
+	config, err := SetupTLSConfig(s.cfg)
+	if err != nil {
+		return err
+	}
+	// Configs returned by GetConfigForClient replace the config gRPC
+	// negotiates the protocol with
+	config.NextProtos = []string{"h2"}
+
+	cert := &config.Certificates[0]
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.config = config
+	s.mu.Unlock()
+
+	certificateExpiry.Set(cert.Leaf.NotAfter.Unix())
+	zap.L().Info("serving TLS certificate",
+		zap.String("subject", cert.Leaf.Subject.String()),
+		zap.String("serial", cert.Leaf.SerialNumber.String()),
+		zap.Time("not_after", cert.Leaf.NotAfter),
+	)
+	return nil
+}
+
+// Watch reloads the config whenever the certificate, key, CA or CRL file
+// changes until the returned function is called. The result of each reload is
+// passed to onReload if it is not nil.
+func (s *ServerTLS) Watch(onReload ReloadHandler) (func(), error) {
+	files := []string{s.cfg.CertFile, s.cfg.KeyFile, s.cfg.CAFile}
+	if s.cfg.CRLFile != "" {
+		files = append(files, s.cfg.CRLFile)
+	}
+	return watchFiles("TLS", files, s.Reload, onReload)
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	defaultSubjectClaim = "sub"
+	// TokenSubjectPrefix prefixes the subjects of tokens, so that they are
+	// distinct from the subjects of client certificates.
+	TokenSubjectPrefix = "jwt:"
+)
+
+var ErrorInvalidToken = errors.New("invalid token")
+
+type TokenConfig struct {
+	// KeyFile is a PEM encoded RSA public key verifying RS256, RS384 and RS512
+	// signed tokens, or else the secret of HS256, HS384 and HS512 signed
+	// tokens without trailing newlines.
+	KeyFile string
+	// SubjectClaim is the claim that identifies clients, "sub" if empty.
+	SubjectClaim string
+	// Issuer and Audience are the required "iss" and "aud" claims, which are
+	// not checked if empty.
+	Issuer   string
+	Audience string
+}
+
+// TokenVerifier verifies signed JWTs, which must expire.
+type TokenVerifier struct {
+	cfg TokenConfig
+	key any
+}
+
+func NewTokenVerifier(cfg TokenConfig) (*TokenVerifier, error) {
+	data, err := os.ReadFile(cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.SubjectClaim == "" {
+		cfg.SubjectClaim = defaultSubjectClaim
+	}
+
+	v := &TokenVerifier{cfg: cfg}
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "-----BEGIN") {
+		if v.key, err = jwt.ParseRSAPublicKeyFromPEM(data); err != nil {
+			return nil, fmt.Errorf("failed to parse token key %q: %w", cfg.KeyFile, err)
+		}
+	} else {
+		if len(bytes.TrimSpace(data)) == 0 {
+			return nil, fmt.Errorf("token key %q is empty", cfg.KeyFile)
+		}
+		v.key = bytes.TrimRight(data, "\r\n")
+	}
+	return v, nil
+}
+
+// TokenSubject is the subject of clients identified by the subject claim of
+// tokens of the issuer, in the form jwt:<issuer>/<subject>. The issuer is
+// empty for tokens without an "iss" claim.
+func TokenSubject(issuer string, subject string) string {
+	return TokenSubjectPrefix + issuer + "/" + subject
+}
+
+// Verify returns the subject of the token, see TokenSubject.
+func (v *TokenVerifier) Verify(token string) (string, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		// Only accept the algorithms of the key, so that a public key cannot
+		// be used as an HMAC secret
+		switch v.key.(type) {
+		case *rsa.PublicKey:
+			if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+				return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+			}
+		default:
+			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+			}
+		}
+		return v.key, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrorInvalidToken, err)
+	}
+
+	now := time.Now().Unix()
+	switch {
+	case !claims.VerifyExpiresAt(now, true):
+		return "", fmt.Errorf("%w: token has no expiry or has expired", ErrorInvalidToken)
+	case v.cfg.Issuer != "" && !claims.VerifyIssuer(v.cfg.Issuer, true):
+		return "", fmt.Errorf("%w: unexpected issuer", ErrorInvalidToken)
+	case v.cfg.Audience != "" && !claims.VerifyAudience(v.cfg.Audience, true):
+		return "", fmt.Errorf("%w: unexpected audience", ErrorInvalidToken)
+	}
+
+	subject, ok := claims[v.cfg.SubjectClaim].(string)
+	if !ok || subject == "" {
+		return "", fmt.Errorf("%w: no %q claim", ErrorInvalidToken, v.cfg.SubjectClaim)
+	}
+	issuer, _ := claims["iss"].(string)
+	return TokenSubject(issuer, subject), nil
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// reloadDelay is how long to wait for further changes to watched files before
+// reloading them, so that a file is not loaded while it is being written.
+const reloadDelay = 100 * time.Millisecond
+
+// ReloadHandler is called with the result of each reload of watched files.
+type ReloadHandler func(name string, files []string, err error)
+
+// watchFiles calls reload whenever one of the files changes until the returned
+// function is called. Failed reloads are logged, and reload must keep what it
+// loaded previously when it fails. The result of each reload is passed to
+// onReload if it is not nil.
+func watchFiles(name string, files []string, reload func() error, onReload ReloadHandler) (func(), error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	// Watch the directories so that files replaced by renaming another file
+	// over them are still watched
+	watched := map[string]bool{}
+	for _, file := range files {
+		file = filepath.Clean(file)
+		watched[file] = true
+		if err := watcher.Add(filepath.Dir(file)); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+
+	stopCh := make(chan bool)
+	doneCh := make(chan bool)
+	go func() {
+		defer close(doneCh)
+		defer func() {
+			if closeErr := watcher.Close(); closeErr != nil {
+				zap.L().Error("error closing watcher", zap.String("name", name), zap.Error(closeErr))
+			}
+		}()
+
+		timer := time.NewTimer(reloadDelay)
+		timer.Stop()
+		for {
+			select {
+			case <-stopCh:
+				timer.Stop()
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if watched[filepath.Clean(event.Name)] && event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+					timer.Reset(reloadDelay)
+				}
+			case <-timer.C:
+				fields := []zap.Field{zap.String("name", name), zap.Strings("files", files)}
+				err := reload()
+				if err != nil {
+					zap.L().Error("error reloading files, keeping the previous files", append(fields, zap.Error(err))...)
+				} else {
+					zap.L().Info("reloaded files", fields...)
+				}
+				if onReload != nil {
+					onReload(name, files, err)
+				}
+			case watchErr, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				zap.L().Error("error watching files", zap.String("name", name), zap.Error(watchErr))
+			}
+		}
+	}()
+
+	return func() {
+		close(stopCh)
+		<-doneCh
+	}, nil
+}
@@ -3,22 +3,92 @@ package config
 import (
 	"errors"
 	"flag"
+	"fmt"
 	"os"
+	"path/filepath"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
 
 type Cert struct {
-	ACLModelFile   string `yaml:"ACLModelFile"`
-	ACLPolicyFile  string `yaml:"ACLPolicyFile"`
-	ServerCertFile string `yaml:"ServerCertFile"`
-	ServerKeyFile  string `yaml:"ServerKeyFile"`
-	CAFile         string `yaml:"CAFile"`
+	ACLModelFile  string `yaml:"ACLModelFile"`
+	ACLPolicyFile string `yaml:"ACLPolicyFile"`
+	// CommandPolicyFile restricts the commands clients may run, which are not
+	// restricted if it is unset.
+	CommandPolicyFile string `yaml:"CommandPolicyFile"`
+	ServerCertFile    string `yaml:"ServerCertFile"`
+	ServerKeyFile     string `yaml:"ServerKeyFile"`
+	CAFile            string `yaml:"CAFile"`
+	// CRLFile lists revoked client certificates, which are rejected.
+	CRLFile string `yaml:"CRLFile"`
+	// Identity is the client certificate field that identifies clients: cn
+	// (the default), dns, email or spiffe.
+	Identity string `yaml:"Identity"`
+}
+
+// TokenAuth lets clients authenticate with signed JWTs instead of client
+// certificates.
+type TokenAuth struct {
+	// KeyFile is a PEM encoded RSA public key or an HMAC secret.
+	KeyFile string `yaml:"KeyFile"`
+	// SubjectClaim is the claim that identifies clients, "sub" if unset. Clients
+	// are identified as jwt:<iss>/<subject claim>.
+	SubjectClaim string `yaml:"SubjectClaim"`
+	Issuer       string `yaml:"Issuer"`
+	Audience     string `yaml:"Audience"`
+}
+
+// Audit is the audit log of every call and job lifecycle event.
+type Audit struct {
+	File string `yaml:"File"`
+	// MaxSizeMB is the size in megabytes after which the log is rotated, which
+	// is not rotated if it is unset.
+	MaxSizeMB int `yaml:"MaxSizeMB"`
+	// MaxBackups is the number of rotated logs kept, 1 if unset.
+	MaxBackups int `yaml:"MaxBackups"`
+}
+
+// Retention limits the completed jobs kept, which are deleted oldest first
+// along with their logs. Unset limits are unlimited.
+type Retention struct {
+	// MaxAge is how long jobs are kept after they complete, e.g. "168h".
+	MaxAge       time.Duration `yaml:"MaxAge"`
+	MaxCount     int           `yaml:"MaxCount"`
+	MaxLogSizeMB int64         `yaml:"MaxLogSizeMB"`
+	// Interval is how often completed jobs are collected, every minute if
+	// unset.
+	Interval time.Duration `yaml:"Interval"`
+}
+
+// RunAs is the default user and groups jobs run as.
+type RunAs struct {
+	UID    uint32   `yaml:"UID"`
+	GID    uint32   `yaml:"GID"`
+	Groups []uint32 `yaml:"Groups"`
 }
 
 type Config struct {
-	Port int  `yaml:"Port"`
-	Cert Cert `yaml:"Cert"`
+	Port int `yaml:"Port"`
+	// MetricsAddress is the address metrics are served on at /debug/vars,
+	// which are not served if it is unset.
+	MetricsAddress string     `yaml:"MetricsAddress"`
+	Cert           Cert       `yaml:"Cert"`
+	TokenAuth      *TokenAuth `yaml:"TokenAuth"`
+	Audit          *Audit     `yaml:"Audit"`
+	// LogDir is the directory the logs and other files of jobs are kept in,
+	// one subdirectory per job. It must be an absolute path and is created if
+	// it does not exist. It defaults to a directory in the temporary
+	// directory, which the OS may clean.
+	LogDir string `yaml:"LogDir"`
+	// JobStoreFile is the database jobs are recorded in so that they can be
+	// queried after restarts, which are only kept in memory if it is unset.
+	JobStoreFile string `yaml:"JobStoreFile"`
+	// Retention limits the completed jobs kept, which are kept forever if it
+	// is unset.
+	Retention  *Retention `yaml:"Retention"`
+	CgroupRoot string     `yaml:"CgroupRoot"`
+	RunAs      *RunAs     `yaml:"RunAs"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -34,10 +104,30 @@ func LoadConfig() (*Config, error) {
 	if err := readFile(filepath, &cfg); err != nil {
 		return nil, err
 	}
+	cfg.setDefaults()
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
 
 	return &cfg, nil
 }
 
+// setDefaults sets the defaults of unset options that have one.
+func (c *Config) setDefaults() {
+	if c.LogDir == "" {
+		// Jobs wrote their logs to the temporary directory before LogDir
+		// could be configured
+		c.LogDir = filepath.Join(os.TempDir(), "jobrunner")
+	}
+}
+
+func (c *Config) validate() error {
+	if !filepath.IsAbs(c.LogDir) {
+		return fmt.Errorf("LogDir %q must be an absolute path", c.LogDir)
+	}
+	return nil
+}
+
 func readFile(filePath string, out *Config) error {
 	f, err := os.Open(filePath)
 	if err != nil {
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testCA issues certificates for tests.
+type testCA struct {
+	dir      string
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	CertFile string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	ca := &testCA{dir: t.TempDir()}
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	ca.cert, ca.key, ca.CertFile, _ = ca.create(t, "ca", template, nil, nil)
+	return ca
+}
+
+// issueServer issues a certificate for the test server which expires after
+// the duration.
+func (ca *testCA) issueServer(t *testing.T, name string, expiry time.Duration) (*x509.Certificate, string, string) {
+	return ca.issue(t, name, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		IPAddresses: []net.IP{rpcAddr.IP},
+		NotAfter:    time.Now().Add(expiry).Truncate(time.Second),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+}
+
+// issueClient issues a client certificate with the subject and SANs of the
+// template.
+func (ca *testCA) issueClient(t *testing.T, name string, template *x509.Certificate) (*x509.Certificate, string, string) {
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	return ca.issue(t, name, template)
+}
+
+func (ca *testCA) issue(t *testing.T, name string, template *x509.Certificate) (*x509.Certificate, string, string) {
+	cert, _, certFile, keyFile := ca.create(t, name, template, ca.cert, ca.key)
+	return cert, certFile, keyFile
+}
+
+// create creates a certificate signed by the parent, or self-signed if it is
+// nil, and writes it and its key to PEM files.
+func (ca *testCA) create(t *testing.T, name string, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template.SerialNumber, err = rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	require.NoError(t, err)
+	template.NotBefore = time.Now().Add(-time.Minute)
+	if template.NotAfter.IsZero() {
+		template.NotAfter = time.Now().Add(time.Hour)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(ca.dir, name+".pem")
+	keyFile := filepath.Join(ca.dir, name+"-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return cert, key, certFile, keyFile
+}
+
+// writeCRL writes a CRL revoking the certificates to the file.
+func (ca *testCA) writeCRL(t *testing.T, file string, revoked ...*x509.Certificate) {
+	template := &x509.RevocationList{
+		Number:     big.NewInt(time.Now().UnixNano()),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+	}
+	for _, cert := range revoked {
+		template.RevokedCertificates = append(template.RevokedCertificates, pkix.RevokedCertificate{
+			SerialNumber:   cert.SerialNumber,
+			RevocationTime: time.Now(),
+		})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, template, ca.cert, ca.key)
+	require.NoError(t, err)
+	writePEM(t, file, "X509 CRL", der)
+}
+
+// writePEM replaces the file with the PEM encoded block by renaming a new file
+// over it, like certificate rotation tools do.
+func writePEM(t *testing.T, file string, blockType string, der []byte) {
+	tmp := file + ".tmp"
+	require.NoError(t, os.WriteFile(tmp, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600))
+	require.NoError(t, os.Rename(tmp, file))
+}
+
+func newClientTemplate(commonName string) *x509.Certificate {
+	return &x509.Certificate{
+		Subject: pkix.Name{CommonName: commonName},
+	}
+}
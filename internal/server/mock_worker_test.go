@@ -34,62 +34,121 @@ func (m *MockWorker) EXPECT() *MockWorkerMockRecorder {
 	return m.recorder
 }
 
+// DeleteJob mocks base method.
+func (m *MockWorker) DeleteJob(arg0 string, arg1 func(worker.JobSummary) error) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteJob", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteJob indicates an expected call of DeleteJob.
+func (mr *MockWorkerMockRecorder) DeleteJob(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteJob", reflect.TypeOf((*MockWorker)(nil).DeleteJob), arg0, arg1)
+}
+
+// DescribeJob mocks base method.
+func (m *MockWorker) DescribeJob(arg0 string) (worker.JobSummary, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DescribeJob", arg0)
+	ret0, _ := ret[0].(worker.JobSummary)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DescribeJob indicates an expected call of DescribeJob.
+func (mr *MockWorkerMockRecorder) DescribeJob(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DescribeJob", reflect.TypeOf((*MockWorker)(nil).DescribeJob), arg0)
+}
+
 // FollowLogs mocks base method.
-func (m *MockWorker) FollowLogs(arg0 string) (<-chan string, worker.CancelFunc, error) {
+func (m *MockWorker) FollowLogs(arg0 string, arg1 worker.LogStream) (<-chan worker.LogLine, worker.CancelFunc, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FollowLogs", arg0)
-	ret0, _ := ret[0].(<-chan string)
+	ret := m.ctrl.Call(m, "FollowLogs", arg0, arg1)
+	ret0, _ := ret[0].(<-chan worker.LogLine)
 	ret1, _ := ret[1].(worker.CancelFunc)
 	ret2, _ := ret[2].(error)
 	return ret0, ret1, ret2
 }
 
 // FollowLogs indicates an expected call of FollowLogs.
-func (mr *MockWorkerMockRecorder) FollowLogs(arg0 interface{}) *gomock.Call {
+func (mr *MockWorkerMockRecorder) FollowLogs(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FollowLogs", reflect.TypeOf((*MockWorker)(nil).FollowLogs), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FollowLogs", reflect.TypeOf((*MockWorker)(nil).FollowLogs), arg0, arg1)
 }
 
-// QueryJob mocks base method.
-func (m *MockWorker) QueryJob(arg0 string) (worker.JobStatus, error) {
+// ListJobs mocks base method.
+func (m *MockWorker) ListJobs(arg0 worker.ListOptions) (worker.JobList, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "QueryJob", arg0)
-	ret0, _ := ret[0].(worker.JobStatus)
+	ret := m.ctrl.Call(m, "ListJobs", arg0)
+	ret0, _ := ret[0].(worker.JobList)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// QueryJob indicates an expected call of QueryJob.
-func (mr *MockWorkerMockRecorder) QueryJob(arg0 interface{}) *gomock.Call {
+// ListJobs indicates an expected call of ListJobs.
+func (mr *MockWorkerMockRecorder) ListJobs(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryJob", reflect.TypeOf((*MockWorker)(nil).QueryJob), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListJobs", reflect.TypeOf((*MockWorker)(nil).ListJobs), arg0)
+}
+
+// Shutdown mocks base method.
+func (m *MockWorker) Shutdown(arg0 worker.StopOptions) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Shutdown", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Shutdown indicates an expected call of Shutdown.
+func (mr *MockWorkerMockRecorder) Shutdown(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Shutdown", reflect.TypeOf((*MockWorker)(nil).Shutdown), arg0)
 }
 
 // StartJob mocks base method.
-func (m *MockWorker) StartJob(arg0 worker.Command) (*worker.Job, error) {
+func (m *MockWorker) StartJob(arg0 worker.Command, arg1 worker.Metadata) (*worker.Job, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "StartJob", arg0)
+	ret := m.ctrl.Call(m, "StartJob", arg0, arg1)
 	ret0, _ := ret[0].(*worker.Job)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // StartJob indicates an expected call of StartJob.
-func (mr *MockWorkerMockRecorder) StartJob(arg0 interface{}) *gomock.Call {
+func (mr *MockWorkerMockRecorder) StartJob(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartJob", reflect.TypeOf((*MockWorker)(nil).StartJob), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartJob", reflect.TypeOf((*MockWorker)(nil).StartJob), arg0, arg1)
 }
 
 // StopJob mocks base method.
-func (m *MockWorker) StopJob(arg0 string) error {
+func (m *MockWorker) StopJob(arg0 string, arg1 worker.StopOptions) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "StopJob", arg0)
+	ret := m.ctrl.Call(m, "StopJob", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // StopJob indicates an expected call of StopJob.
-func (mr *MockWorkerMockRecorder) StopJob(arg0 interface{}) *gomock.Call {
+func (mr *MockWorkerMockRecorder) StopJob(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StopJob", reflect.TypeOf((*MockWorker)(nil).StopJob), arg0, arg1)
+}
+
+// StopJobs mocks base method.
+func (m *MockWorker) StopJobs(arg0 worker.JobFilter, arg1 worker.StopOptions) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StopJobs", arg0, arg1)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// StopJobs indicates an expected call of StopJobs.
+func (mr *MockWorkerMockRecorder) StopJobs(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StopJob", reflect.TypeOf((*MockWorker)(nil).StopJob), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StopJobs", reflect.TypeOf((*MockWorker)(nil).StopJobs), arg0, arg1)
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"net"
+	"strings"
 	"time"
 
 	grpcauth "github.com/grpc-ecosystem/go-grpc-middleware/auth"
@@ -13,17 +14,30 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 
+	"github.com/joshjon/jobrunner/internal/audit"
+	"github.com/joshjon/jobrunner/internal/auth"
 	servicepb "github.com/joshjon/jobrunner/proto/gen/service/v1"
 )
 
+const authorizationMetadataKey = "authorization"
+
 type Config struct {
 	Address string
 	Service servicepb.ServiceServer
 	TLS     *tls.Config
+	// Identity is the client certificate field that identifies clients, the
+	// common name if empty.
+	Identity auth.IdentitySource
+	// Tokens verifies the bearer tokens clients may authenticate with instead
+	// of a certificate. Tokens are not accepted if it is nil.
+	Tokens *auth.TokenVerifier
+	// Audit logs every call, which are not audited if it is nil.
+	Audit *audit.Logger
 }
 
 type Server struct {
@@ -45,7 +59,8 @@ func New(config Config, opts ...grpc.ServerOption) (*Server, error) {
 					return zap.Duration("duration", duration)
 				},
 			)),
-			grpcauth.UnaryServerInterceptor(authenticate),
+			config.Audit.UnaryServerInterceptor(),
+			grpcauth.UnaryServerInterceptor(authenticate(config.Identity, config.Tokens)),
 		),
 		grpc.ChainStreamInterceptor(
 			grpczap.StreamServerInterceptor(zap.L(), grpczap.WithDurationField(
@@ -53,7 +68,8 @@ func New(config Config, opts ...grpc.ServerOption) (*Server, error) {
 					return zap.Duration("duration", duration)
 				},
 			)),
-			grpcauth.StreamServerInterceptor(authenticate),
+			config.Audit.StreamServerInterceptor(),
+			grpcauth.StreamServerInterceptor(authenticate(config.Identity, config.Tokens)),
 		),
 	)
 
@@ -84,18 +100,64 @@ func (s *Server) Stop() {
 	s.grpcServer.GracefulStop()
 }
 
-func authenticate(ctx context.Context) (context.Context, error) {
-	peer, ok := peer.FromContext(ctx)
-	if !ok {
-		return ctx, status.New(codes.Unknown, "couldn't find peer info").Err()
-	}
-
-	if peer.AuthInfo == nil {
-		return ctx, status.New(codes.Unauthenticated, "no transport security being used").Err()
+// authenticate identifies clients by their bearer token if they send one, or
+// else by the identity of their certificate from the source.
+func authenticate(identity auth.IdentitySource, tokens *auth.TokenVerifier) grpcauth.AuthFunc {
+	return func(ctx context.Context) (context.Context, error) {
+		peer, ok := peer.FromContext(ctx)
+		if !ok {
+			return ctx, status.New(codes.Unknown, "couldn't find peer info").Err()
+		}
+
+		if peer.AuthInfo == nil {
+			return ctx, status.New(codes.Unauthenticated, "no transport security being used").Err()
+		}
+
+		if md, _ := metadata.FromIncomingContext(ctx); len(md.Get(authorizationMetadataKey)) > 0 {
+			if tokens == nil {
+				return ctx, status.New(codes.Unauthenticated, "bearer tokens are not accepted").Err()
+			}
+			token, err := grpcauth.AuthFromMD(ctx, "bearer")
+			if err != nil {
+				return ctx, err
+			}
+			subject, err := tokens.Verify(token)
+			if err != nil {
+				return ctx, status.New(codes.Unauthenticated, err.Error()).Err()
+			}
+			return withSubject(ctx, subject), nil
+		}
+
+		tlsInfo := peer.AuthInfo.(credentials.TLSInfo)
+		if len(tlsInfo.State.VerifiedChains) == 0 {
+			return ctx, status.New(codes.Unauthenticated, "no client certificate or bearer token").Err()
+		}
+		subject, err := auth.Identity(tlsInfo.State.VerifiedChains[0][0], identity)
+		if err != nil {
+			return ctx, status.New(codes.Unauthenticated, err.Error()).Err()
+		}
+		// Certificates must not impersonate the subjects of tokens
+		if strings.HasPrefix(subject, auth.TokenSubjectPrefix) {
+			return ctx, status.Newf(codes.Unauthenticated, "certificate identity must not start with %q", auth.TokenSubjectPrefix).Err()
+		}
+		return withSubject(ctx, subject), nil
 	}
+}
 
-	tlsInfo := peer.AuthInfo.(credentials.TLSInfo)
-	subject := tlsInfo.State.VerifiedChains[0][0].Subject.CommonName
+// withSubject returns a context with the authenticated subject and the domain
+// of the request.
+func withSubject(ctx context.Context, subject string) context.Context {
 	ctx = context.WithValue(ctx, subjectContextKey{}, subject)
-	return ctx, nil
+
+	domain := DefaultDomain
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(DomainMetadataKey); len(values) > 0 && values[0] != "" {
+			domain = values[0]
+		}
+	}
+	audit.Annotate(ctx, func(event *audit.Event) {
+		event.Subject = subject
+		event.Domain = domain
+	})
+	return context.WithValue(ctx, domainContextKey{}, domain)
 }
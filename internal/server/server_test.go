@@ -0,0 +1,495 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"expvar"
+	"fmt"
+	"math/big"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/joshjon/jobrunner/internal/audit"
+	"github.com/joshjon/jobrunner/internal/auth"
+	"github.com/joshjon/jobrunner/pkg/worker"
+	servicepb "github.com/joshjon/jobrunner/proto/gen/service/v1"
+)
+
+func TestServer_rotateCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert, serverCertFile, serverKeyFile := ca.issueServer(t, "server", time.Hour)
+	_, clientCertFile, clientKeyFile := ca.issueClient(t, "client", newClientTemplate("root"))
+
+	serverTLS, err := auth.NewServerTLS(auth.TLSConfig{
+		CertFile: serverCertFile,
+		KeyFile:  serverKeyFile,
+		CAFile:   ca.CertFile,
+	})
+	require.NoError(t, err)
+	unwatch, err := serverTLS.Watch(nil)
+	require.NoError(t, err)
+	defer unwatch()
+
+	ctrl := gomock.NewController(t)
+	mockWorker := NewMockWorker(ctrl)
+	mockWorker.EXPECT().StartJob(gomock.Any(), gomock.Any()).Return(&worker.Job{ID: "1"}, nil).Times(2)
+	srv := newServerWithTLS(t, &Service{worker: mockWorker, authorizer: auth.New(ACLModelFile, ACLPolicyFile)}, serverTLS.Config())
+
+	clientTLS := newTestClientTLS(t, ca, clientCertFile, clientKeyFile)
+	client, conn := newTestClient(t, clientTLS)
+	deps := &dependencies{server: srv, client: client, clientConn: conn, mockWorker: mockWorker, ctrl: ctrl}
+	defer deps.close()
+
+	startJob := func() {
+		_, err := deps.client.Start(context.Background(), &servicepb.StartRequest{Command: &servicepb.Command{Cmd: "some-command"}})
+		require.NoError(t, err)
+	}
+	servedSerial := func() *big.Int {
+		conn, err := tls.Dial("tcp", rpcAddr.String(), clientTLS)
+		require.NoError(t, err)
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber
+	}
+
+	startJob()
+	require.Equal(t, serverCert.SerialNumber, servedSerial())
+	require.Equal(t, strconv.FormatInt(serverCert.NotAfter.Unix(), 10), expvar.Get("tls_certificate_expiry_seconds").String())
+
+	rotatedCert, _, _ := ca.issueServer(t, "server", 2*time.Hour)
+	require.Eventually(t, func() bool {
+		return servedSerial().Cmp(rotatedCert.SerialNumber) == 0
+	}, 5*time.Second, 50*time.Millisecond)
+	require.Equal(t, strconv.FormatInt(rotatedCert.NotAfter.Unix(), 10), expvar.Get("tls_certificate_expiry_seconds").String())
+
+	// Established connections are not affected
+	startJob()
+}
+
+func TestServer_revokedCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	_, serverCertFile, serverKeyFile := ca.issueServer(t, "server", time.Hour)
+	_, rootCertFile, rootKeyFile := ca.issueClient(t, "root", newClientTemplate("root"))
+	leakedCert, leakedCertFile, leakedKeyFile := ca.issueClient(t, "leaked", newClientTemplate("root"))
+	crlFile := filepath.Join(t.TempDir(), "crl.pem")
+	ca.writeCRL(t, crlFile)
+
+	rejected := make(chan *x509.Certificate, 100)
+	serverTLS, err := auth.NewServerTLS(auth.TLSConfig{
+		CertFile:  serverCertFile,
+		KeyFile:   serverKeyFile,
+		CAFile:    ca.CertFile,
+		CRLFile:   crlFile,
+		OnRevoked: func(cert *x509.Certificate) { rejected <- cert },
+	})
+	require.NoError(t, err)
+	unwatch, err := serverTLS.Watch(nil)
+	require.NoError(t, err)
+	defer unwatch()
+
+	ctrl := gomock.NewController(t)
+	mockWorker := NewMockWorker(ctrl)
+	mockWorker.EXPECT().StartJob(gomock.Any(), gomock.Any()).Return(&worker.Job{ID: "1"}, nil).AnyTimes()
+	srv := newServerWithTLS(t, &Service{worker: mockWorker, authorizer: auth.New(ACLModelFile, ACLPolicyFile)}, serverTLS.Config())
+	defer srv.Stop()
+
+	startJob := func(certFile string, keyFile string) error {
+		client, conn := newTestClient(t, newTestClientTLS(t, ca, certFile, keyFile))
+		defer conn.Close()
+		_, err := client.Start(context.Background(), &servicepb.StartRequest{Command: &servicepb.Command{Cmd: "some-command"}})
+		return err
+	}
+	require.NoError(t, startJob(leakedCertFile, leakedKeyFile))
+
+	ca.writeCRL(t, crlFile, leakedCert)
+	require.Eventually(t, func() bool {
+		return status.Code(startJob(leakedCertFile, leakedKeyFile)) == codes.Unavailable
+	}, 5*time.Second, 50*time.Millisecond)
+	require.Equal(t, leakedCert.SerialNumber, (<-rejected).SerialNumber)
+	require.NoError(t, startJob(rootCertFile, rootKeyFile))
+
+	// CRLs must be signed by a CA
+	otherCA := newTestCA(t)
+	otherCA.writeCRL(t, crlFile)
+	require.Error(t, serverTLS.Reload())
+	require.Equal(t, codes.Unavailable, status.Code(startJob(leakedCertFile, leakedKeyFile)))
+}
+
+func TestServer_identity(t *testing.T) {
+	ca := newTestCA(t)
+	_, serverCertFile, serverKeyFile := ca.issueServer(t, "server", time.Hour)
+	spiffeID, err := url.Parse("spiffe://example.org/ns/ci/sa/deployer")
+	require.NoError(t, err)
+	_, clientCertFile, clientKeyFile := ca.issueClient(t, "client", &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "deployer"},
+		DNSNames:       []string{"deployer.example.org", "ci.example.org"},
+		EmailAddresses: []string{"deployer@example.org"},
+		URIs:           []*url.URL{spiffeID},
+	})
+	_, cnOnlyCertFile, cnOnlyKeyFile := ca.issueClient(t, "cn-only", newClientTemplate("deployer"))
+	_, tokenCertFile, tokenKeyFile := ca.issueClient(t, "token", newClientTemplate(auth.TokenSubjectPrefix+"issuer/deployer"))
+
+	serverTLS, err := auth.NewServerTLS(auth.TLSConfig{CertFile: serverCertFile, KeyFile: serverKeyFile, CAFile: ca.CertFile})
+	require.NoError(t, err)
+
+	tests := []struct {
+		source      auth.IdentitySource
+		certFile    string
+		keyFile     string
+		wantSubject string
+	}{
+		{source: "", certFile: clientCertFile, keyFile: clientKeyFile, wantSubject: "deployer"},
+		{source: auth.IdentityCommonName, certFile: clientCertFile, keyFile: clientKeyFile, wantSubject: "deployer"},
+		{source: auth.IdentityDNS, certFile: clientCertFile, keyFile: clientKeyFile, wantSubject: "deployer.example.org"},
+		{source: auth.IdentityEmail, certFile: clientCertFile, keyFile: clientKeyFile, wantSubject: "deployer@example.org"},
+		{source: auth.IdentitySPIFFE, certFile: clientCertFile, keyFile: clientKeyFile, wantSubject: spiffeID.String()},
+		{source: auth.IdentitySPIFFE, certFile: cnOnlyCertFile, keyFile: cnOnlyKeyFile},
+		// Certificates cannot impersonate the subjects of tokens
+		{source: auth.IdentityCommonName, certFile: tokenCertFile, keyFile: tokenKeyFile},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %s", tt.source, filepath.Base(tt.certFile)), func(t *testing.T) {
+			policyFile := filepath.Join(t.TempDir(), "policy.csv")
+			policy := fmt.Sprintf("p, %s, *, *, create\n", tt.wantSubject)
+			require.NoError(t, os.WriteFile(policyFile, []byte(policy), 0600))
+
+			ctrl := gomock.NewController(t)
+			mockWorker := NewMockWorker(ctrl)
+			srv := newServerWithConfig(t, Config{
+				Address:  rpcAddr.String(),
+				Service:  &Service{worker: mockWorker, authorizer: auth.New(ACLModelFile, policyFile)},
+				TLS:      serverTLS.Config(),
+				Identity: tt.source,
+			})
+			client, conn := newTestClient(t, newTestClientTLS(t, ca, tt.certFile, tt.keyFile))
+			deps := &dependencies{server: srv, client: client, clientConn: conn, mockWorker: mockWorker, ctrl: ctrl}
+			defer deps.close()
+
+			if tt.wantSubject != "" {
+				mockWorker.EXPECT().StartJob(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ worker.Command, metadata worker.Metadata) (*worker.Job, error) {
+						require.Equal(t, tt.wantSubject, metadata.Owner)
+						return &worker.Job{ID: "1"}, nil
+					}).Times(1)
+			}
+			_, err := client.Start(context.Background(), &servicepb.StartRequest{Command: &servicepb.Command{Cmd: "some-command"}})
+			if tt.wantSubject == "" {
+				require.Equal(t, codes.Unauthenticated, status.Code(err))
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestServer_spiffeOwners(t *testing.T) {
+	ca := newTestCA(t)
+	_, serverCertFile, serverKeyFile := ca.issueServer(t, "server", time.Hour)
+	issue := func(id string) (*url.URL, string, string) {
+		spiffeID, err := url.Parse(id)
+		require.NoError(t, err)
+		_, certFile, keyFile := ca.issueClient(t, path.Base(id), &x509.Certificate{
+			Subject: pkix.Name{CommonName: path.Base(id)},
+			URIs:    []*url.URL{spiffeID},
+		})
+		return spiffeID, certFile, keyFile
+	}
+	// The ID of the CI namespace is a prefix of the ID of a workload in it
+	_, ciCertFile, ciKeyFile := issue("spiffe://example.org/ns/ci")
+	deployerID, deployerCertFile, deployerKeyFile := issue("spiffe://example.org/ns/ci/sa/deployer")
+
+	serverTLS, err := auth.NewServerTLS(auth.TLSConfig{CertFile: serverCertFile, KeyFile: serverKeyFile, CAFile: ca.CertFile})
+	require.NoError(t, err)
+	policyFile := filepath.Join(t.TempDir(), "policy.csv")
+	require.NoError(t, os.WriteFile(policyFile, []byte("p, owner, *, jobs/*, read\np, owner, *, jobs/*, delete\n"), 0600))
+
+	ctrl := gomock.NewController(t)
+	mockWorker := NewMockWorker(ctrl)
+	job := worker.JobSummary{ID: "1", Metadata: worker.Metadata{Owner: deployerID.String(), Domain: DefaultDomain}}
+	mockWorker.EXPECT().DescribeJob(job.ID).Return(job, nil).AnyTimes()
+	srv := newServerWithConfig(t, Config{
+		Address:  rpcAddr.String(),
+		Service:  &Service{worker: mockWorker, authorizer: auth.New(ACLModelFile, policyFile)},
+		TLS:      serverTLS.Config(),
+		Identity: auth.IdentitySPIFFE,
+	})
+	defer srv.Stop()
+
+	ciClient, ciConn := newTestClient(t, newTestClientTLS(t, ca, ciCertFile, ciKeyFile))
+	defer ciConn.Close()
+	_, err = ciClient.Query(context.Background(), &servicepb.QueryRequest{JobId: job.ID})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = ciClient.Stop(context.Background(), &servicepb.StopRequest{JobId: job.ID})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = ciClient.ListJobs(context.Background(), &servicepb.ListJobsRequest{Owner: deployerID.String()})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	deployerClient, deployerConn := newTestClient(t, newTestClientTLS(t, ca, deployerCertFile, deployerKeyFile))
+	defer deployerConn.Close()
+	resp, err := deployerClient.Query(context.Background(), &servicepb.QueryRequest{JobId: job.ID})
+	require.NoError(t, err)
+	require.Equal(t, deployerID.String(), resp.Owner)
+}
+
+func TestServer_tokenAuth(t *testing.T) {
+	ca := newTestCA(t)
+	_, serverCertFile, serverKeyFile := ca.issueServer(t, "server", time.Hour)
+	_, clientCertFile, clientKeyFile := ca.issueClient(t, "client", newClientTemplate("root"))
+
+	dir := t.TempDir()
+	secret := []byte("secret")
+	secretFile := filepath.Join(dir, "secret")
+	require.NoError(t, os.WriteFile(secretFile, append(secret, '\n'), 0600))
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	publicKeyFile := filepath.Join(dir, "public.pem")
+	require.NoError(t, os.WriteFile(publicKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER}), 0600))
+
+	serverTLS, err := auth.NewServerTLS(auth.TLSConfig{
+		CertFile:           serverCertFile,
+		KeyFile:            serverKeyFile,
+		CAFile:             ca.CertFile,
+		ClientCertOptional: true,
+	})
+	require.NoError(t, err)
+	// Clients authenticating with tokens only verify the server
+	tokenClientTLS := &tls.Config{
+		RootCAs:    newTestClientTLS(t, ca, clientCertFile, clientKeyFile).RootCAs,
+		ServerName: rpcAddr.IP.String(),
+		MinVersion: tls.VersionTLS13,
+	}
+
+	sign := func(method jwt.SigningMethod, key any, claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		require.NoError(t, err)
+		return token
+	}
+	expiry := time.Now().Add(time.Hour).Unix()
+
+	tests := []struct {
+		name        string
+		tokens      auth.TokenConfig
+		clientTLS   *tls.Config
+		token       string
+		wantSubject string
+		// denied is whether the subject is not permitted to start jobs.
+		denied bool
+	}{
+		{
+			name:        "hmac",
+			tokens:      auth.TokenConfig{KeyFile: secretFile},
+			clientTLS:   tokenClientTLS,
+			token:       sign(jwt.SigningMethodHS256, secret, jwt.MapClaims{"sub": "ci-runner", "exp": expiry}),
+			wantSubject: "jwt:/ci-runner",
+		},
+		{
+			name:        "rsa with subject claim, issuer and audience",
+			tokens:      auth.TokenConfig{KeyFile: publicKeyFile, SubjectClaim: "client_id", Issuer: "ci", Audience: "jobrunner"},
+			clientTLS:   tokenClientTLS,
+			token:       sign(jwt.SigningMethodRS512, rsaKey, jwt.MapClaims{"client_id": "ci-runner", "iss": "ci", "aud": "jobrunner", "exp": expiry}),
+			wantSubject: "jwt:ci/ci-runner",
+		},
+		{
+			// Tokens do not get the permissions of the certificate user
+			name:        "token with subject of certificate user",
+			tokens:      auth.TokenConfig{KeyFile: secretFile},
+			clientTLS:   tokenClientTLS,
+			token:       sign(jwt.SigningMethodHS256, secret, jwt.MapClaims{"sub": "root", "exp": expiry}),
+			wantSubject: "jwt:/root",
+			denied:      true,
+		},
+		{
+			name:        "client certificate without token",
+			tokens:      auth.TokenConfig{KeyFile: secretFile},
+			clientTLS:   newTestClientTLS(t, ca, clientCertFile, clientKeyFile),
+			wantSubject: "root",
+		},
+		{
+			name:      "expired token",
+			tokens:    auth.TokenConfig{KeyFile: secretFile},
+			clientTLS: tokenClientTLS,
+			token:     sign(jwt.SigningMethodHS256, secret, jwt.MapClaims{"sub": "ci-runner", "exp": time.Now().Add(-time.Minute).Unix()}),
+		},
+		{
+			name:      "token without expiry",
+			tokens:    auth.TokenConfig{KeyFile: secretFile},
+			clientTLS: tokenClientTLS,
+			token:     sign(jwt.SigningMethodHS256, secret, jwt.MapClaims{"sub": "ci-runner"}),
+		},
+		{
+			name:      "wrong secret",
+			tokens:    auth.TokenConfig{KeyFile: secretFile},
+			clientTLS: tokenClientTLS,
+			token:     sign(jwt.SigningMethodHS256, []byte("other"), jwt.MapClaims{"sub": "ci-runner", "exp": expiry}),
+		},
+		{
+			name:      "public key as hmac secret",
+			tokens:    auth.TokenConfig{KeyFile: publicKeyFile},
+			clientTLS: tokenClientTLS,
+			token:     sign(jwt.SigningMethodHS256, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER}), jwt.MapClaims{"sub": "ci-runner", "exp": expiry}),
+		},
+		{
+			name:      "wrong audience",
+			tokens:    auth.TokenConfig{KeyFile: secretFile, Audience: "jobrunner"},
+			clientTLS: tokenClientTLS,
+			token:     sign(jwt.SigningMethodHS256, secret, jwt.MapClaims{"sub": "ci-runner", "aud": "other", "exp": expiry}),
+		},
+		{
+			name:      "neither token nor client certificate",
+			tokens:    auth.TokenConfig{KeyFile: secretFile},
+			clientTLS: tokenClientTLS,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := auth.NewTokenVerifier(tt.tokens)
+			require.NoError(t, err)
+
+			policyFile := filepath.Join(t.TempDir(), "policy.csv")
+			require.NoError(t, os.WriteFile(policyFile, []byte("p, jwt:/ci-runner, *, *, create\np, jwt:ci/ci-runner, *, *, create\np, root, *, *, create\n"), 0600))
+
+			ctrl := gomock.NewController(t)
+			mockWorker := NewMockWorker(ctrl)
+			srv := newServerWithConfig(t, Config{
+				Address: rpcAddr.String(),
+				Service: &Service{worker: mockWorker, authorizer: auth.New(ACLModelFile, policyFile)},
+				TLS:     serverTLS.Config(),
+				Tokens:  tokens,
+			})
+			client, conn := newTestClient(t, tt.clientTLS)
+			deps := &dependencies{server: srv, client: client, clientConn: conn, mockWorker: mockWorker, ctrl: ctrl}
+			defer deps.close()
+
+			if tt.wantSubject != "" && !tt.denied {
+				mockWorker.EXPECT().StartJob(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ worker.Command, metadata worker.Metadata) (*worker.Job, error) {
+						require.Equal(t, tt.wantSubject, metadata.Owner)
+						return &worker.Job{ID: "1"}, nil
+					}).Times(1)
+			}
+			ctx := context.Background()
+			if tt.token != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+tt.token)
+			}
+			_, err = client.Start(ctx, &servicepb.StartRequest{Command: &servicepb.Command{Cmd: "some-command"}})
+			if tt.wantSubject == "" {
+				require.Equal(t, codes.Unauthenticated, status.Code(err))
+				return
+			}
+			if tt.denied {
+				s, _ := status.FromError(err)
+				require.Equal(t, codes.PermissionDenied, s.Code())
+				require.Contains(t, s.Message(), tt.wantSubject+" not permitted")
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestServer_tokenAuthDisabled(t *testing.T) {
+	deps := setup(t, RootClientCertFile, RootClientKeyFile)
+	defer deps.close()
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer token")
+	_, err := deps.client.Start(ctx, &servicepb.StartRequest{Command: &servicepb.Command{Cmd: "some-command"}})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestServer_audit(t *testing.T) {
+	auditFile := filepath.Join(t.TempDir(), "audit.log")
+	auditLog, err := audit.Open(auditFile, audit.Options{})
+	require.NoError(t, err)
+	defer auditLog.Close()
+	serverTLS, err := newTLSConfig(auth.TypeServer, ServerCertFile, ServerKeyFile)
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	mockWorker := NewMockWorker(ctrl)
+	srv := newServerWithConfig(t, Config{
+		Address: rpcAddr.String(),
+		Service: &Service{worker: mockWorker, authorizer: auth.New(ACLModelFile, ACLPolicyFile)},
+		TLS:     serverTLS,
+		Audit:   auditLog,
+	})
+	client, conn := newClient(t, RootClientCertFile, RootClientKeyFile)
+	deps := &dependencies{server: srv, client: client, clientConn: conn, mockWorker: mockWorker, ctrl: ctrl}
+	defer deps.close()
+
+	mockWorker.EXPECT().StartJob(gomock.Any(), gomock.Any()).Return(&worker.Job{ID: "1"}, nil).Times(1)
+	_, err = client.Start(context.Background(), &servicepb.StartRequest{
+		Command: &servicepb.Command{Cmd: "echo", Args: []string{"hello"}},
+	})
+	require.NoError(t, err)
+
+	nobodyClient, nobodyConn := newClient(t, NobodyClientCertFile, NobodyClientKeyFile)
+	defer nobodyConn.Close()
+	mockWorker.EXPECT().DescribeJob("1").Return(jobSummary("1", "root"), nil).Times(1)
+	_, err = nobodyClient.Query(context.Background(), &servicepb.QueryRequest{JobId: "1"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	data, err := os.ReadFile(auditFile)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+
+	var start, query audit.Event
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &start))
+	require.Equal(t, audit.KindRPC, start.Kind)
+	require.Equal(t, "root", start.Subject)
+	require.Equal(t, DefaultDomain, start.Domain)
+	require.Equal(t, "/service.v1.Service/Start", start.RPC)
+	require.Equal(t, "1", start.JobID)
+	require.Equal(t, "echo", start.Cmd)
+	require.Equal(t, []string{"hello"}, start.Args)
+	require.Equal(t, audit.DecisionAllow, start.Decision)
+	require.Equal(t, codes.OK.String(), start.Outcome)
+
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &query))
+	require.Equal(t, "nobody", query.Subject)
+	require.Equal(t, "1", query.JobID)
+	require.Equal(t, audit.DecisionDeny, query.Decision)
+	require.Equal(t, codes.PermissionDenied.String(), query.Outcome)
+	require.NotEmpty(t, query.Error)
+}
+
+func newTestClientTLS(t *testing.T, ca *testCA, certFile string, keyFile string) *tls.Config {
+	clientTLS, err := auth.SetupTLSConfig(auth.TLSConfig{
+		CertFile:      certFile,
+		KeyFile:       keyFile,
+		CAFile:        ca.CertFile,
+		ServerAddress: rpcAddr.IP.String(),
+		Type:          auth.TypeClient,
+	})
+	require.NoError(t, err)
+	return clientTLS
+}
+
+func newTestClient(t *testing.T, clientTLS *tls.Config) (servicepb.ServiceClient, *grpc.ClientConn) {
+	conn, err := grpc.Dial(rpcAddr.String(), grpc.WithTransportCredentials(credentials.NewTLS(clientTLS)))
+	require.NoError(t, err)
+	return servicepb.NewServiceClient(conn), conn
+}
@@ -4,28 +4,88 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
 
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"github.com/joshjon/jobrunner/internal/audit"
 	"github.com/joshjon/jobrunner/internal/auth"
 	"github.com/joshjon/jobrunner/pkg/worker"
 	servicepb "github.com/joshjon/jobrunner/proto/gen/service/v1"
 )
 
+const (
+	// DomainMetadataKey is the request metadata key of the tenant domain a
+	// request is made in, DefaultDomain if unset.
+	DomainMetadataKey = "jobrunner-domain"
+	DefaultDomain     = "default"
+)
+
 const (
 	objectWildcard = "*"
+	aclObject      = "acl"
 	createAction   = "create"
 	readAction     = "read"
 	deleteAction   = "delete"
+	runAsAction    = "runas"
+	inspectAction  = "inspect"
+	// purgeAction deletes the record and logs of completed jobs, unlike
+	// deleteAction which stops jobs.
+	purgeAction = "purge"
 )
 
 type Worker interface {
-	StartJob(worker.Command) (*worker.Job, error)
-	StopJob(string) error
-	QueryJob(string) (worker.JobStatus, error)
-	FollowLogs(string) (<-chan string, worker.CancelFunc, error)
+	StartJob(worker.Command, worker.Metadata) (*worker.Job, error)
+	StopJob(string, worker.StopOptions) error
+	StopJobs(worker.JobFilter, worker.StopOptions) ([]string, error)
+	DescribeJob(string) (worker.JobSummary, error)
+	FollowLogs(string, worker.LogStream) (<-chan worker.LogLine, worker.CancelFunc, error)
+	ListJobs(worker.ListOptions) (worker.JobList, error)
+	DeleteJob(string, func(worker.JobSummary) error) (int64, error)
+	Shutdown(worker.StopOptions) error
+}
+
+var states = map[worker.JobState]servicepb.State{
+	worker.JobStateUnspecified:   servicepb.State_STATE_UNSPECIFIED,
+	worker.JobStateQueued:        servicepb.State_STATE_QUEUED,
+	worker.JobStateStarting:      servicepb.State_STATE_STARTING,
+	worker.JobStateRunning:       servicepb.State_STATE_RUNNING,
+	worker.JobStateSucceeded:     servicepb.State_STATE_SUCCEEDED,
+	worker.JobStateFailed:        servicepb.State_STATE_FAILED,
+	worker.JobStateStopped:       servicepb.State_STATE_STOPPED,
+	worker.JobStateTimedOut:      servicepb.State_STATE_TIMED_OUT,
+	worker.JobStateFailedToStart: servicepb.State_STATE_FAILED_TO_START,
+	worker.JobStateLost:          servicepb.State_STATE_LOST,
+}
+
+// streams maps the API output streams to the log streams of jobs, where
+// unspecified is both streams.
+var streams = map[servicepb.Stream]worker.LogStream{
+	servicepb.Stream_STREAM_UNSPECIFIED: worker.LogStreamAll,
+	servicepb.Stream_STREAM_STDOUT:      worker.LogStreamStdout,
+	servicepb.Stream_STREAM_STDERR:      worker.LogStreamStderr,
+}
+
+// signals maps the API signals to the signals sent to jobs.
+var signals = map[servicepb.Signal]syscall.Signal{
+	servicepb.Signal_SIGNAL_SIGHUP:  syscall.SIGHUP,
+	servicepb.Signal_SIGNAL_SIGINT:  syscall.SIGINT,
+	servicepb.Signal_SIGNAL_SIGQUIT: syscall.SIGQUIT,
+	servicepb.Signal_SIGNAL_SIGABRT: syscall.SIGABRT,
+	servicepb.Signal_SIGNAL_SIGKILL: syscall.SIGKILL,
+	servicepb.Signal_SIGNAL_SIGUSR1: syscall.SIGUSR1,
+	servicepb.Signal_SIGNAL_SIGSEGV: syscall.SIGSEGV,
+	servicepb.Signal_SIGNAL_SIGUSR2: syscall.SIGUSR2,
+	servicepb.Signal_SIGNAL_SIGPIPE: syscall.SIGPIPE,
+	servicepb.Signal_SIGNAL_SIGALRM: syscall.SIGALRM,
+	servicepb.Signal_SIGNAL_SIGTERM: syscall.SIGTERM,
 }
 
 var (
@@ -33,89 +93,254 @@ var (
 	ErrorInternalServer = status.Error(codes.Internal, "Internal server error")
 )
 
+type ServiceConfig struct {
+	// LogDir is the directory jobs write their files to, which is created if
+	// it does not exist.
+	LogDir        string
+	ACLModelFile  string
+	ACLPolicyFile string
+	// CommandPolicyFile restricts the commands subjects may run, which are not
+	// restricted if it is empty.
+	CommandPolicyFile string
+	WorkerOptions     []worker.Option
+	// Audit logs reloads of the ACL, which are not audited if it is nil.
+	Audit *audit.Logger
+}
+
 type Service struct {
 	servicepb.UnimplementedServiceServer
 	worker     Worker
 	authorizer Authorizer
+	commands   *auth.CommandPolicy
+	// unwatchACL stops reloading the ACL when its files change.
+	unwatchACL func()
 }
 
-func NewService(logDir string, aclModelFile string, aclPolicyFile string) *Service {
-	return &Service{
-		worker:     worker.NewWorker(logDir),
-		authorizer: auth.New(aclModelFile, aclPolicyFile),
+func NewService(config ServiceConfig) (*Service, error) {
+	if err := worker.PrepareLogDir(config.LogDir); err != nil {
+		return nil, err
+	}
+
+	authorizer := auth.New(config.ACLModelFile, config.ACLPolicyFile)
+	unwatchACL, err := authorizer.Watch(config.Audit.Reload)
+	if err != nil {
+		return nil, fmt.Errorf("error watching ACL files: %w", err)
+	}
+
+	// Pick up the jobs left running if the server crashed
+	w := worker.NewWorker(config.LogDir, config.WorkerOptions...)
+	if err := w.Reconcile(); err != nil {
+		unwatchACL()
+		return nil, fmt.Errorf("error reconciling jobs: %w", err)
+	}
+
+	service := &Service{
+		worker:     w,
+		authorizer: authorizer,
+		unwatchACL: unwatchACL,
+	}
+
+	if config.CommandPolicyFile != "" {
+		commands, err := auth.LoadCommandPolicy(config.CommandPolicyFile)
+		if err != nil {
+			unwatchACL()
+			return nil, err
+		}
+		service.commands = commands
 	}
+
+	return service, nil
 }
 
 func (s *Service) Start(ctx context.Context, req *servicepb.StartRequest) (*servicepb.StartResponse, error) {
-	if err := s.authorizer.Authorize(subject(ctx), objectWildcard, createAction); err != nil {
+	audit.Annotate(ctx, func(event *audit.Event) {
+		event.Cmd = req.GetCommand().GetCmd()
+		event.Args = req.GetCommand().GetArgs()
+	})
+
+	if err := s.authorizer.Authorize(subject(ctx), domain(ctx), objectWildcard, createAction); err != nil {
 		return nil, err
 	}
 
+	if s.commands != nil {
+		roles := s.authorizer.Permissions(subject(ctx), domain(ctx)).Roles
+		command := auth.Command{
+			Cmd:    req.Command.Cmd,
+			Args:   req.Command.Args,
+			Env:    req.Command.Env,
+			RootFS: req.Command.Rootfs,
+		}
+		for _, mount := range req.Command.BindMounts {
+			command.BindMounts = append(command.BindMounts, mount.Source)
+		}
+		if err := s.commands.Authorize(subject(ctx), roles, domain(ctx), command); err != nil {
+			return nil, err
+		}
+	}
+
 	cmd := worker.Command{
-		Cmd:  req.Command.Cmd,
-		Args: req.Command.Args,
+		Cmd:        req.Command.Cmd,
+		Args:       req.Command.Args,
+		Limits:     resourceLimits(req.Limits),
+		RootFS:     req.Command.Rootfs,
+		BindMounts: bindMounts(req.Command.BindMounts),
+		Env:        req.Command.Env,
+		ClearEnv:   req.Command.ClearEnv,
+		Dir:        req.Command.Dir,
+		Stdin:      req.Stdin,
+		Timeout:    time.Duration(req.TimeoutMs) * time.Millisecond,
+	}
+	if runAs := req.Command.RunAs; runAs != nil {
+		// The groups are authorized too, as any of them may be privileged
+		objects := []string{userObject(runAs.Uid), groupObject(runAs.Gid)}
+		for _, gid := range runAs.Groups {
+			objects = append(objects, groupObject(gid))
+		}
+		for _, object := range objects {
+			if err := s.authorizer.Authorize(subject(ctx), domain(ctx), object, runAsAction); err != nil {
+				return nil, err
+			}
+		}
+		cmd.RunAs = &worker.Credential{
+			UID:    runAs.Uid,
+			GID:    runAs.Gid,
+			Groups: runAs.Groups,
+		}
+	}
+	if req.Isolation != nil {
+		cmd.Isolation = &worker.Isolation{
+			HostNetwork: req.Isolation.HostNetwork,
+		}
 	}
 
-	job, err := s.worker.StartJob(cmd)
+	job, err := s.worker.StartJob(cmd, worker.Metadata{
+		Owner:       subject(ctx),
+		Domain:      domain(ctx),
+		Labels:      req.Labels,
+		Annotations: req.Annotations,
+	})
 	if err != nil {
 		return nil, s.handleError(err)
 	}
+	audit.Annotate(ctx, func(event *audit.Event) {
+		event.JobID = job.ID
+	})
 
 	return &servicepb.StartResponse{
-		JobId: job.ID,
+		JobId:     job.ID,
+		JobStatus: toJobStatus(job.ID, job.Query()),
 	}, nil
 }
 
 func (s *Service) Stop(ctx context.Context, req *servicepb.StopRequest) (*servicepb.StopResponse, error) {
-	if err := s.authorizer.Authorize(subject(ctx), objectWildcard, deleteAction); err != nil {
+	annotateJob(ctx, req.JobId)
+	if _, err := s.authorizeJob(subject(ctx), domain(ctx), req.JobId, deleteAction); err != nil {
+		return nil, err
+	}
+
+	opts, err := stopOptions(req.Signal, req.GracePeriodMs)
+	if err != nil {
 		return nil, err
 	}
 
-	err := s.worker.StopJob(req.JobId)
+	err = s.worker.StopJob(req.JobId, opts)
 	if err != nil {
 		return nil, s.handleError(err)
 	}
 	return &servicepb.StopResponse{}, nil
 }
 
-func (s *Service) Query(ctx context.Context, req *servicepb.QueryRequest) (*servicepb.QueryResponse, error) {
-	if err := s.authorizer.Authorize(subject(ctx), objectWildcard, readAction); err != nil {
+func (s *Service) StopJobs(ctx context.Context, req *servicepb.StopJobsRequest) (*servicepb.StopJobsResponse, error) {
+	owner, err := s.authorizeOwner(subject(ctx), domain(ctx), req.Owner, deleteAction)
+	if err != nil {
 		return nil, err
 	}
 
-	jobStatus, err := s.worker.QueryJob(req.JobId)
+	// Require a selector so that all jobs are not stopped by accident
+	if strings.TrimSpace(req.LabelSelector) == "" {
+		return nil, status.Error(codes.InvalidArgument, "label selector is required")
+	}
+	selector, err := worker.ParseSelector(req.LabelSelector)
 	if err != nil {
 		return nil, s.handleError(err)
 	}
 
-	var state servicepb.State
+	opts, err := stopOptions(req.Signal, req.GracePeriodMs)
+	if err != nil {
+		return nil, err
+	}
 
-	switch jobStatus.State {
-	case worker.JobStateUnspecified:
-		state = servicepb.State_STATE_UNSPECIFIED
-	case worker.JobStateRunning:
-		state = servicepb.State_STATE_RUNNING
-	case worker.JobStateCompleted:
-		state = servicepb.State_STATE_COMPLETED
+	// Jobs that could not be stopped are reported along with the stopped ones
+	jobIDs, err := s.worker.StopJobs(worker.JobFilter{Owner: owner, Domain: domain(ctx), Selector: selector}, opts)
+	failedJobIDs, err := failedStops(err)
+	if err != nil {
+		return nil, s.handleError(err)
+	}
+	audit.Annotate(ctx, func(event *audit.Event) {
+		event.JobIDs = jobIDs
+		if len(failedJobIDs) > 0 {
+			event.Error = fmt.Sprintf("failed to stop jobs %s", strings.Join(failedJobIDs, ", "))
+		}
+	})
+	return &servicepb.StopJobsResponse{
+		JobIds:       jobIDs,
+		FailedJobIds: failedJobIDs,
+	}, nil
+}
+
+// failedStops returns the IDs of the jobs that StopJobs could not stop, which
+// are logged, or err if it is not made of such failures.
+func failedStops(err error) ([]string, error) {
+	if err == nil {
+		return nil, nil
+	}
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+
+	var failedJobIDs []string
+	for _, err := range errs {
+		var stopErr *worker.StopJobError
+		if !errors.As(err, &stopErr) {
+			return nil, err
+		}
+		zap.L().Error("error stopping job", zap.String("job", stopErr.JobID), zap.Error(stopErr.Err))
+		failedJobIDs = append(failedJobIDs, stopErr.JobID)
+	}
+	return failedJobIDs, nil
+}
+
+func (s *Service) Query(ctx context.Context, req *servicepb.QueryRequest) (*servicepb.QueryResponse, error) {
+	annotateJob(ctx, req.JobId)
+	job, err := s.authorizeJob(subject(ctx), domain(ctx), req.JobId, readAction)
+	if err != nil {
+		return nil, err
 	}
 
 	resp := &servicepb.QueryResponse{
-		JobStatus: &servicepb.JobStatus{
-			Id:       req.JobId,
-			State:    state,
-			ExitCode: int64(jobStatus.ExitCode),
-		},
+		JobStatus:   toJobStatus(req.JobId, job.Status),
+		Labels:      job.Metadata.Labels,
+		Owner:       job.Metadata.Owner,
+		Domain:      job.Metadata.Domain,
+		Annotations: job.Metadata.Annotations,
 	}
 
 	return resp, nil
 }
 
 func (s *Service) FollowLogs(req *servicepb.FollowLogsRequest, stream servicepb.Service_FollowLogsServer) error {
-	if err := s.authorizer.Authorize(subject(stream.Context()), objectWildcard, readAction); err != nil {
+	annotateJob(stream.Context(), req.JobId)
+	if _, err := s.authorizeJob(subject(stream.Context()), domain(stream.Context()), req.JobId, readAction); err != nil {
 		return err
 	}
 
-	logCh, cancel, err := s.worker.FollowLogs(req.JobId)
+	logStream, ok := streams[req.Stream]
+	if !ok {
+		return status.Errorf(codes.InvalidArgument, "unsupported stream %v", req.Stream)
+	}
+
+	logCh, cancel, err := s.worker.FollowLogs(req.JobId, logStream)
 	if err != nil {
 		return s.handleError(err)
 	}
@@ -129,8 +354,12 @@ func (s *Service) FollowLogs(req *servicepb.FollowLogsRequest, stream servicepb.
 			if !ok {
 				return nil
 			}
-			resp := &servicepb.FollowLogsResponse{
-				Log: log,
+			resp := &servicepb.FollowLogsResponse{Log: log.Text}
+			switch log.Stream {
+			case worker.LogStreamStdout:
+				resp.Stream = servicepb.Stream_STREAM_STDOUT
+			case worker.LogStreamStderr:
+				resp.Stream = servicepb.Stream_STREAM_STDERR
 			}
 			if err = stream.Send(resp); err != nil {
 				return s.handleError(err)
@@ -139,17 +368,312 @@ func (s *Service) FollowLogs(req *servicepb.FollowLogsRequest, stream servicepb.
 	}
 }
 
+func (s *Service) ListJobs(ctx context.Context, req *servicepb.ListJobsRequest) (*servicepb.ListJobsResponse, error) {
+	owner, err := s.authorizeOwner(subject(ctx), domain(ctx), req.Owner, readAction)
+	if err != nil {
+		return nil, err
+	}
+
+	selector, err := worker.ParseSelector(req.LabelSelector)
+	if err != nil {
+		return nil, s.handleError(err)
+	}
+
+	opts := worker.ListOptions{
+		JobFilter: worker.JobFilter{
+			Owner:    owner,
+			Domain:   domain(ctx),
+			Selector: selector,
+		},
+		PageSize:  int(req.PageSize),
+		PageToken: req.PageToken,
+	}
+	for _, state := range req.States {
+		opts.States = append(opts.States, jobState(state))
+	}
+	if req.CreatedAfter != nil {
+		opts.CreatedAfter = req.CreatedAfter.AsTime()
+	}
+	if req.CreatedBefore != nil {
+		opts.CreatedBefore = req.CreatedBefore.AsTime()
+	}
+
+	list, err := s.worker.ListJobs(opts)
+	if err != nil {
+		return nil, s.handleError(err)
+	}
+
+	resp := &servicepb.ListJobsResponse{
+		NextPageToken: list.NextPageToken,
+	}
+	for _, job := range list.Jobs {
+		resp.Jobs = append(resp.Jobs, &servicepb.JobSummary{
+			Id:          job.ID,
+			Owner:       job.Metadata.Owner,
+			Cmd:         job.Cmd,
+			Args:        job.Args,
+			CreateTime:  timestamp(job.CreateTime),
+			Status:      toJobStatus(job.ID, job.Status),
+			Labels:      job.Metadata.Labels,
+			Domain:      job.Metadata.Domain,
+			Annotations: job.Metadata.Annotations,
+		})
+	}
+
+	return resp, nil
+}
+
+// DeleteJob deletes a completed job along with its logs.
+func (s *Service) DeleteJob(ctx context.Context, req *servicepb.DeleteJobRequest) (*servicepb.DeleteJobResponse, error) {
+	annotateJob(ctx, req.JobId)
+	// The job is authorized by the worker as it is deleted
+	var authErr error
+	reclaimed, err := s.worker.DeleteJob(req.JobId, func(job worker.JobSummary) error {
+		authErr = s.authorizeJobSummary(subject(ctx), domain(ctx), job, purgeAction)
+		return authErr
+	})
+	switch {
+	case authErr != nil:
+		return nil, authErr
+	case errors.Is(err, worker.ErrorJobNotFound):
+		return nil, s.authorizeMissingJob(subject(ctx), domain(ctx), purgeAction)
+	case err != nil:
+		return nil, s.handleError(err)
+	}
+	return &servicepb.DeleteJobResponse{
+		ReclaimedBytes: reclaimed,
+	}, nil
+}
+
+// GetPermissions returns the effective permissions of a subject in a domain.
+// Inspecting the permissions of other subjects or in other domains requires
+// permission to inspect the ACL.
+func (s *Service) GetPermissions(ctx context.Context, req *servicepb.GetPermissionsRequest) (*servicepb.GetPermissionsResponse, error) {
+	sub, dom := req.Subject, req.Domain
+	if sub == "" {
+		sub = subject(ctx)
+	}
+	if dom == "" {
+		dom = domain(ctx)
+	}
+	if sub != subject(ctx) || dom != domain(ctx) {
+		if err := s.authorizer.Authorize(subject(ctx), dom, aclObject, inspectAction); err != nil {
+			return nil, err
+		}
+	}
+
+	perms := s.authorizer.Permissions(sub, dom)
+	resp := &servicepb.GetPermissionsResponse{
+		Roles: perms.Roles,
+	}
+	for _, policy := range perms.Policies {
+		resp.Permissions = append(resp.Permissions, &servicepb.Permission{
+			Role:   policy.Role,
+			Domain: policy.Domain,
+			Object: policy.Object,
+			Action: policy.Action,
+		})
+	}
+
+	return resp, nil
+}
+
+// Shutdown stops all running jobs and reloading the ACL.
+func (s *Service) Shutdown() error {
+	if s.unwatchACL != nil {
+		s.unwatchACL()
+	}
+	return s.worker.Shutdown(worker.StopOptions{})
+}
+
+// authorizeJob authorizes the action on every job in the domain, or else on
+// the job itself, which policies identify by its owner and ID. Jobs of other
+// domains are not found. It returns the job if the action is authorized.
+func (s *Service) authorizeJob(subject string, domain string, jobID string, action string) (worker.JobSummary, error) {
+	job, err := s.worker.DescribeJob(jobID)
+	if err != nil {
+		return worker.JobSummary{}, s.authorizeMissingJob(subject, domain, action)
+	}
+	if err := s.authorizeJobSummary(subject, domain, job, action); err != nil {
+		return worker.JobSummary{}, err
+	}
+	return job, nil
+}
+
+// authorizeJobSummary authorizes the action on the job, which is not found in
+// other domains than its own.
+func (s *Service) authorizeJobSummary(subject string, domain string, job worker.JobSummary, action string) error {
+	if job.Metadata.Domain != domain {
+		return s.authorizeMissingJob(subject, domain, action)
+	}
+	if err := s.authorizer.Authorize(subject, domain, objectWildcard, action); err != nil {
+		if err := s.authorizer.Authorize(subject, domain, auth.JobObject(job.Metadata.Owner, job.ID), action); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// authorizeMissingJob returns ErrorJobNotFound if the subject may perform the
+// action on every job in the domain, or else the authorization error, so that
+// it is not revealed whether jobs the subject may not access exist.
+func (s *Service) authorizeMissingJob(subject string, domain string, action string) error {
+	if err := s.authorizer.Authorize(subject, domain, objectWildcard, action); err != nil {
+		return err
+	}
+	return ErrorJobNotFound
+}
+
+// authorizeOwner authorizes the action on every job in the domain, or else on
+// all jobs of the owner, which defaults to the subject. It returns the owner
+// the action is limited to, if any.
+func (s *Service) authorizeOwner(subject string, domain string, owner string, action string) (string, error) {
+	if err := s.authorizer.Authorize(subject, domain, objectWildcard, action); err == nil {
+		return owner, nil
+	}
+
+	if owner == "" {
+		owner = subject
+	}
+	if err := s.authorizer.Authorize(subject, domain, auth.JobObject(owner, objectWildcard), action); err != nil {
+		return "", err
+	}
+	return owner, nil
+}
+
 func (s *Service) handleError(err error) error {
-	if err.Error() == ErrorJobNotFound.Error() {
+	switch {
+	case errors.Is(err, worker.ErrorJobNotFound), err.Error() == ErrorJobNotFound.Error():
 		return ErrorJobNotFound
+	case errors.Is(err, worker.ErrorInvalidCommand), errors.Is(err, worker.ErrorInvalidLimits),
+		errors.Is(err, worker.ErrorInvalidListOptions), errors.Is(err, worker.ErrorInvalidLabels),
+		errors.Is(err, worker.ErrorInvalidAnnotations), errors.Is(err, worker.ErrorInvalidSelector):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, worker.ErrorCgroupUnavailable), errors.Is(err, worker.ErrorJobNotStarted),
+		errors.Is(err, worker.ErrorJobNotCompleted):
+		return status.Error(codes.FailedPrecondition, err.Error())
 	}
 
 	zap.L().Error("unexpected error occurred", zap.Error(err))
 	return ErrorInternalServer
 }
 
+func resourceLimits(limits *servicepb.ResourceLimits) *worker.ResourceLimits {
+	if limits == nil {
+		return nil
+	}
+
+	ioMax := make([]worker.IOMax, len(limits.IoMax))
+	for i, io := range limits.IoMax {
+		ioMax[i] = worker.IOMax{
+			Device:    io.Device,
+			ReadBPS:   io.ReadBps,
+			WriteBPS:  io.WriteBps,
+			ReadIOPS:  io.ReadIops,
+			WriteIOPS: io.WriteIops,
+		}
+	}
+
+	return &worker.ResourceLimits{
+		CPUWeight: limits.CpuWeight,
+		CPUQuota:  time.Duration(limits.CpuQuotaUs) * time.Microsecond,
+		CPUPeriod: time.Duration(limits.CpuPeriodUs) * time.Microsecond,
+		MemoryMax: limits.MemoryMaxBytes,
+		IOMax:     ioMax,
+	}
+}
+
+func bindMounts(mounts []*servicepb.BindMount) []worker.BindMount {
+	var bindMounts []worker.BindMount
+	for _, mount := range mounts {
+		bindMounts = append(bindMounts, worker.BindMount{
+			Source: mount.Source,
+			Target: mount.Target,
+		})
+	}
+	return bindMounts
+}
+
+func stopOptions(sig servicepb.Signal, gracePeriodMs int64) (worker.StopOptions, error) {
+	if gracePeriodMs < 0 {
+		return worker.StopOptions{}, status.Error(codes.InvalidArgument, "grace period must not be negative")
+	}
+	opts := worker.StopOptions{
+		GracePeriod: time.Duration(gracePeriodMs) * time.Millisecond,
+	}
+	if sig != servicepb.Signal_SIGNAL_UNSPECIFIED {
+		var ok bool
+		if opts.Signal, ok = signals[sig]; !ok {
+			return worker.StopOptions{}, status.Errorf(codes.InvalidArgument, "unsupported signal %v", sig)
+		}
+	}
+	return opts, nil
+}
+
+func toJobStatus(jobID string, jobStatus worker.JobStatus) *servicepb.JobStatus {
+	resp := &servicepb.JobStatus{
+		Id:        jobID,
+		State:     states[jobStatus.State],
+		ExitCode:  int64(jobStatus.ExitCode),
+		Signal:    signal(jobStatus.Signal),
+		StartTime: timestamp(jobStatus.StartTime),
+		EndTime:   timestamp(jobStatus.EndTime),
+	}
+	if jobStatus.ExitError != nil {
+		resp.Error = jobStatus.ExitError.Error()
+	}
+	return resp
+}
+
+// jobState returns the worker state for the API state, or unspecified if it
+// has none.
+func jobState(state servicepb.State) worker.JobState {
+	for jobState, s := range states {
+		if s == state {
+			return jobState
+		}
+	}
+	return worker.JobStateUnspecified
+}
+
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// signal returns the API signal for sig, or unspecified if it has none.
+func signal(sig syscall.Signal) servicepb.Signal {
+	for apiSig, s := range signals {
+		if s == sig {
+			return apiSig
+		}
+	}
+	return servicepb.Signal_SIGNAL_UNSPECIFIED
+}
+
+// annotateJob records the job a call is made on in its audit event.
+func annotateJob(ctx context.Context, jobID string) {
+	audit.Annotate(ctx, func(event *audit.Event) {
+		event.JobID = jobID
+	})
+}
+
+// userObject is the ACL object for running jobs as the user with the uid.
+func userObject(uid uint32) string {
+	return fmt.Sprintf("uid:%d", uid)
+}
+
+// groupObject is the ACL object for running jobs with the group with the gid,
+// as the primary or a supplementary group.
+func groupObject(gid uint32) string {
+	return fmt.Sprintf("gid:%d", gid)
+}
+
 type Authorizer interface {
-	Authorize(subject, object, action string) error
+	Authorize(subject, domain, object, action string) error
+	Permissions(subject, domain string) auth.Permissions
 }
 
 func subject(ctx context.Context) string {
@@ -157,3 +681,9 @@ func subject(ctx context.Context) string {
 }
 
 type subjectContextKey struct{}
+
+func domain(ctx context.Context) string {
+	return ctx.Value(domainContextKey{}).(string)
+}
+
+type domainContextKey struct{}
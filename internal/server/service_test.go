@@ -3,11 +3,16 @@ package server
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"os"
 	"path/filepath"
 	"runtime"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -16,7 +21,9 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/joshjon/jobrunner/internal/auth"
 	"github.com/joshjon/jobrunner/pkg/worker"
@@ -46,22 +53,288 @@ func TestService_StartJob(t *testing.T) {
 	deps := setup(t, RootClientCertFile, RootClientKeyFile)
 	defer deps.close()
 	wantJob := &worker.Job{ID: "1", Status: worker.JobStatus{State: worker.JobStateRunning}}
-	deps.mockWorker.EXPECT().StartJob(gomock.Any()).Return(wantJob, nil).Times(1)
+	deps.mockWorker.EXPECT().StartJob(gomock.Any(), worker.Metadata{Owner: "root", Domain: DefaultDomain}).Return(wantJob, nil).Times(1)
 	startResp, err := deps.client.Start(context.Background(), &servicepb.StartRequest{Command: &servicepb.Command{Cmd: "some-command"}})
 	require.NoError(t, err)
 	require.NotEmpty(t, startResp.JobId)
 }
 
+func TestService_StartJobLimits(t *testing.T) {
+	deps := setup(t, RootClientCertFile, RootClientKeyFile)
+	defer deps.close()
+	wantCmd := worker.Command{
+		Cmd: "some-command",
+		Limits: &worker.ResourceLimits{
+			CPUWeight: 100,
+			CPUQuota:  50 * time.Millisecond,
+			CPUPeriod: 100 * time.Millisecond,
+			MemoryMax: 1024,
+			IOMax:     []worker.IOMax{{Device: "8:0", ReadBPS: 10, WriteBPS: 20, ReadIOPS: 30, WriteIOPS: 40}},
+		},
+	}
+	limitsErr := fmt.Errorf("%w: memory controller is not delegated", worker.ErrorCgroupUnavailable)
+	deps.mockWorker.EXPECT().StartJob(wantCmd, gomock.Any()).Return(nil, limitsErr).Times(1)
+	_, err := deps.client.Start(context.Background(), &servicepb.StartRequest{
+		Command: &servicepb.Command{Cmd: "some-command"},
+		Limits: &servicepb.ResourceLimits{
+			CpuWeight:      100,
+			CpuQuotaUs:     50000,
+			CpuPeriodUs:    100000,
+			MemoryMaxBytes: 1024,
+			IoMax:          []*servicepb.IOMax{{Device: "8:0", ReadBps: 10, WriteBps: 20, ReadIops: 30, WriteIops: 40}},
+		},
+	})
+	s, _ := status.FromError(err)
+	require.Equal(t, codes.FailedPrecondition, s.Code())
+	require.Equal(t, limitsErr.Error(), s.Message())
+}
+
+func TestService_StartJobIsolation(t *testing.T) {
+	deps := setup(t, RootClientCertFile, RootClientKeyFile)
+	defer deps.close()
+	wantCmd := worker.Command{Cmd: "some-command", Isolation: &worker.Isolation{HostNetwork: true}}
+	wantJob := &worker.Job{ID: "1", Status: worker.JobStatus{State: worker.JobStateRunning}}
+	deps.mockWorker.EXPECT().StartJob(wantCmd, gomock.Any()).Return(wantJob, nil).Times(1)
+	startResp, err := deps.client.Start(context.Background(), &servicepb.StartRequest{
+		Command:   &servicepb.Command{Cmd: "some-command"},
+		Isolation: &servicepb.Isolation{HostNetwork: true},
+	})
+	require.NoError(t, err)
+	require.Equal(t, wantJob.ID, startResp.JobId)
+}
+
+func TestService_StartJobRootFS(t *testing.T) {
+	deps := setup(t, RootClientCertFile, RootClientKeyFile)
+	defer deps.close()
+	wantCmd := worker.Command{
+		Cmd:        "some-command",
+		RootFS:     "rootfs",
+		BindMounts: []worker.BindMount{{Source: "/usr", Target: "/usr"}},
+	}
+	rootFSErr := fmt.Errorf("%w: root filesystem path \"rootfs\" must be absolute", worker.ErrorInvalidCommand)
+	deps.mockWorker.EXPECT().StartJob(wantCmd, gomock.Any()).Return(nil, rootFSErr).Times(1)
+	_, err := deps.client.Start(context.Background(), &servicepb.StartRequest{
+		Command: &servicepb.Command{
+			Cmd:        "some-command",
+			Rootfs:     "rootfs",
+			BindMounts: []*servicepb.BindMount{{Source: "/usr", Target: "/usr"}},
+		},
+	})
+	s, _ := status.FromError(err)
+	require.Equal(t, codes.InvalidArgument, s.Code())
+	require.Equal(t, rootFSErr.Error(), s.Message())
+}
+
+func TestService_StartJobEnvironment(t *testing.T) {
+	deps := setup(t, RootClientCertFile, RootClientKeyFile)
+	defer deps.close()
+	wantCmd := worker.Command{
+		Cmd:      "some-command",
+		Env:      []string{"FOO=bar"},
+		ClearEnv: true,
+		Dir:      "/tmp",
+		Stdin:    []byte("input"),
+	}
+	wantJob := &worker.Job{ID: "1", Status: worker.JobStatus{State: worker.JobStateRunning}}
+	deps.mockWorker.EXPECT().StartJob(wantCmd, gomock.Any()).Return(wantJob, nil).Times(1)
+	_, err := deps.client.Start(context.Background(), &servicepb.StartRequest{
+		Command: &servicepb.Command{Cmd: "some-command", Env: []string{"FOO=bar"}, ClearEnv: true, Dir: "/tmp"},
+		Stdin:   []byte("input"),
+	})
+	require.NoError(t, err)
+}
+
+func TestService_StartJobLabels(t *testing.T) {
+	deps := setup(t, RootClientCertFile, RootClientKeyFile)
+	defer deps.close()
+	labels := map[string]string{"team": "infra", "ticket": "OPS-123"}
+	annotations := map[string]string{"commit": "0123abc"}
+	wantJob := &worker.Job{ID: "1"}
+	wantMetadata := worker.Metadata{Owner: "root", Domain: DefaultDomain, Labels: labels, Annotations: annotations}
+	deps.mockWorker.EXPECT().StartJob(gomock.Any(), wantMetadata).Return(wantJob, nil).Times(1)
+	_, err := deps.client.Start(context.Background(), &servicepb.StartRequest{
+		Command:     &servicepb.Command{Cmd: "some-command"},
+		Labels:      labels,
+		Annotations: annotations,
+	})
+	require.NoError(t, err)
+}
+
+func TestService_StartJobFailedToStart(t *testing.T) {
+	deps := setup(t, RootClientCertFile, RootClientKeyFile)
+	defer deps.close()
+	failedJob := &worker.Job{ID: "1", Status: worker.JobStatus{
+		State:     worker.JobStateFailedToStart,
+		ExitError: errors.New(`exec: "some-command": executable file not found in $PATH`),
+	}}
+	deps.mockWorker.EXPECT().StartJob(gomock.Any(), gomock.Any()).Return(failedJob, nil).Times(1)
+	resp, err := deps.client.Start(context.Background(), &servicepb.StartRequest{
+		Command: &servicepb.Command{Cmd: "some-command"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "1", resp.JobId)
+	require.Equal(t, servicepb.State_STATE_FAILED_TO_START, resp.JobStatus.State)
+	require.Equal(t, `exec: "some-command": executable file not found in $PATH`, resp.JobStatus.Error)
+}
+
+func TestService_StartJobTimeout(t *testing.T) {
+	deps := setup(t, RootClientCertFile, RootClientKeyFile)
+	defer deps.close()
+	wantCmd := worker.Command{Cmd: "some-command", Timeout: 1500 * time.Millisecond}
+	wantJob := &worker.Job{ID: "1", Status: worker.JobStatus{State: worker.JobStateRunning}}
+	deps.mockWorker.EXPECT().StartJob(wantCmd, gomock.Any()).Return(wantJob, nil).Times(1)
+	_, err := deps.client.Start(context.Background(), &servicepb.StartRequest{
+		Command:   &servicepb.Command{Cmd: "some-command"},
+		TimeoutMs: 1500,
+	})
+	require.NoError(t, err)
+}
+
+func TestService_StartJobRunAs(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.csv")
+	policy := "p, root, *, *, create\np, root, *, uid:1000, runas\np, root, *, gid:1000, runas\np, root, *, gid:10, runas\n"
+	require.NoError(t, os.WriteFile(policyFile, []byte(policy), 0600))
+
+	deps := setupWithPolicy(t, RootClientCertFile, RootClientKeyFile, policyFile)
+	defer deps.close()
+
+	t.Run("permitted user", func(t *testing.T) {
+		wantCmd := worker.Command{Cmd: "some-command", RunAs: &worker.Credential{UID: 1000, GID: 1000, Groups: []uint32{10}}}
+		wantJob := &worker.Job{ID: "1", Status: worker.JobStatus{State: worker.JobStateRunning}}
+		deps.mockWorker.EXPECT().StartJob(wantCmd, gomock.Any()).Return(wantJob, nil).Times(1)
+		_, err := deps.client.Start(context.Background(), &servicepb.StartRequest{
+			Command: &servicepb.Command{Cmd: "some-command", RunAs: &servicepb.Credential{Uid: 1000, Gid: 1000, Groups: []uint32{10}}},
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("unpermitted user", func(t *testing.T) {
+		_, err := deps.client.Start(context.Background(), &servicepb.StartRequest{
+			Command: &servicepb.Command{Cmd: "some-command", RunAs: &servicepb.Credential{Uid: 0}},
+		})
+		s, _ := status.FromError(err)
+		require.Equal(t, codes.PermissionDenied, s.Code())
+		require.Equal(t, "root not permitted to runas on uid:0", s.Message())
+	})
+
+	t.Run("unpermitted group", func(t *testing.T) {
+		_, err := deps.client.Start(context.Background(), &servicepb.StartRequest{
+			Command: &servicepb.Command{Cmd: "some-command", RunAs: &servicepb.Credential{Uid: 1000, Gid: 0}},
+		})
+		s, _ := status.FromError(err)
+		require.Equal(t, codes.PermissionDenied, s.Code())
+		require.Equal(t, "root not permitted to runas on gid:0", s.Message())
+	})
+
+	t.Run("unpermitted supplementary group", func(t *testing.T) {
+		_, err := deps.client.Start(context.Background(), &servicepb.StartRequest{
+			Command: &servicepb.Command{Cmd: "some-command", RunAs: &servicepb.Credential{Uid: 1000, Gid: 1000, Groups: []uint32{10, 6}}},
+		})
+		s, _ := status.FromError(err)
+		require.Equal(t, codes.PermissionDenied, s.Code())
+		require.Equal(t, "root not permitted to runas on gid:6", s.Message())
+	})
+}
+
 func TestService_QueryJob(t *testing.T) {
 	deps := setup(t, RootClientCertFile, RootClientKeyFile)
 	defer deps.close()
 	jobID := "job-id"
-	wantJobStatus := worker.JobStatus{State: worker.JobStateRunning}
-	deps.mockWorker.EXPECT().QueryJob(gomock.Any()).Return(wantJobStatus, nil).Times(1)
+	wantJob := worker.JobSummary{
+		ID: jobID,
+		Metadata: worker.Metadata{
+			Domain:      DefaultDomain,
+			Labels:      map[string]string{"team": "infra"},
+			Annotations: map[string]string{"commit": "0123abc"},
+		},
+		Status: worker.JobStatus{State: worker.JobStateRunning},
+	}
+	deps.mockWorker.EXPECT().DescribeJob(jobID).Return(wantJob, nil).Times(1)
 	queryResp, err := deps.client.Query(context.Background(), &servicepb.QueryRequest{JobId: jobID})
 	require.NoError(t, err)
 	require.Equal(t, servicepb.State_STATE_RUNNING, queryResp.JobStatus.State)
 	require.Equal(t, jobID, queryResp.JobStatus.Id)
+	require.Equal(t, map[string]string{"team": "infra"}, queryResp.Labels)
+	require.Equal(t, map[string]string{"commit": "0123abc"}, queryResp.Annotations)
+	require.Equal(t, DefaultDomain, queryResp.Domain)
+}
+
+func TestService_ListJobs(t *testing.T) {
+	deps := setup(t, RootClientCertFile, RootClientKeyFile)
+	defer deps.close()
+	createdAfter := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	wantOpts := worker.ListOptions{
+		JobFilter: worker.JobFilter{
+			States:       []worker.JobState{worker.JobStateRunning, worker.JobStateFailed},
+			Owner:        "root",
+			Domain:       DefaultDomain,
+			CreatedAfter: createdAfter,
+		},
+		PageSize:  10,
+		PageToken: "token",
+	}
+	list := worker.JobList{
+		Jobs: []worker.JobSummary{{
+			ID:         "job-id",
+			Metadata:   worker.Metadata{Owner: "root", Domain: DefaultDomain},
+			Cmd:        "some-command",
+			Args:       []string{"arg"},
+			CreateTime: createdAfter.Add(time.Minute),
+			Status:     worker.JobStatus{State: worker.JobStateRunning},
+		}},
+		NextPageToken: "next-token",
+	}
+	deps.mockWorker.EXPECT().ListJobs(wantOpts).Return(list, nil).Times(1)
+
+	resp, err := deps.client.ListJobs(context.Background(), &servicepb.ListJobsRequest{
+		States:       []servicepb.State{servicepb.State_STATE_RUNNING, servicepb.State_STATE_FAILED},
+		Owner:        "root",
+		CreatedAfter: timestamppb.New(createdAfter),
+		PageSize:     10,
+		PageToken:    "token",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "next-token", resp.NextPageToken)
+	require.Len(t, resp.Jobs, 1)
+
+	job := resp.Jobs[0]
+	require.Equal(t, "job-id", job.Id)
+	require.Equal(t, "root", job.Owner)
+	require.Equal(t, DefaultDomain, job.Domain)
+	require.Equal(t, "some-command", job.Cmd)
+	require.Equal(t, []string{"arg"}, job.Args)
+	require.Equal(t, createdAfter.Add(time.Minute), job.CreateTime.AsTime())
+	require.Equal(t, servicepb.State_STATE_RUNNING, job.Status.State)
+	require.Equal(t, "job-id", job.Status.Id)
+}
+
+func TestService_ListJobsLabelSelector(t *testing.T) {
+	deps := setup(t, RootClientCertFile, RootClientKeyFile)
+	defer deps.close()
+
+	t.Run("valid selector", func(t *testing.T) {
+		selector, err := worker.ParseSelector("team=infra,env!=prod")
+		require.NoError(t, err)
+		deps.mockWorker.EXPECT().ListJobs(worker.ListOptions{JobFilter: worker.JobFilter{Domain: DefaultDomain, Selector: selector}}).Return(worker.JobList{}, nil).Times(1)
+		_, err = deps.client.ListJobs(context.Background(), &servicepb.ListJobsRequest{LabelSelector: "team=infra,env!=prod"})
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid selector", func(t *testing.T) {
+		_, err := deps.client.ListJobs(context.Background(), &servicepb.ListJobsRequest{LabelSelector: "team=in fra"})
+		s, _ := status.FromError(err)
+		require.Equal(t, codes.InvalidArgument, s.Code())
+	})
+}
+
+func TestService_ListJobsInvalidPageToken(t *testing.T) {
+	deps := setup(t, RootClientCertFile, RootClientKeyFile)
+	defer deps.close()
+	deps.mockWorker.EXPECT().ListJobs(gomock.Any()).Return(worker.JobList{}, worker.ErrorInvalidListOptions).Times(1)
+	_, err := deps.client.ListJobs(context.Background(), &servicepb.ListJobsRequest{PageToken: "invalid"})
+	s, _ := status.FromError(err)
+	require.Equal(t, codes.InvalidArgument, s.Code())
 }
 
 func TestService_FollowLogs(t *testing.T) {
@@ -69,7 +342,8 @@ func TestService_FollowLogs(t *testing.T) {
 	defer deps.close()
 	jobID, wantLog, numLogs := "job-id", "test", 10
 	logCh := mockLogs(wantLog, numLogs)
-	deps.mockWorker.EXPECT().FollowLogs(gomock.Any()).Return(logCh, func() {}, nil).Times(1)
+	deps.mockWorker.EXPECT().DescribeJob(jobID).Return(jobSummary(jobID, "root"), nil).Times(1)
+	deps.mockWorker.EXPECT().FollowLogs(jobID, worker.LogStreamAll).Return(logCh, func() {}, nil).Times(1)
 	streamClient, err := deps.client.FollowLogs(context.Background(), &servicepb.FollowLogsRequest{JobId: jobID})
 	require.NoError(t, err)
 
@@ -77,24 +351,266 @@ func TestService_FollowLogs(t *testing.T) {
 		logResp, err := streamClient.Recv()
 		require.NoError(t, err)
 		require.Equal(t, wantLog, logResp.Log)
+		require.Equal(t, servicepb.Stream_STREAM_STDOUT, logResp.Stream)
 	}
 }
 
+func TestService_FollowLogsStream(t *testing.T) {
+	deps := setup(t, RootClientCertFile, RootClientKeyFile)
+	defer deps.close()
+	jobID := "job-id"
+	deps.mockWorker.EXPECT().DescribeJob(jobID).Return(jobSummary(jobID, "root"), nil).AnyTimes()
+
+	t.Run("stderr", func(t *testing.T) {
+		logCh := make(chan worker.LogLine, 1)
+		logCh <- worker.LogLine{Stream: worker.LogStreamStderr, Text: "error"}
+		close(logCh)
+		deps.mockWorker.EXPECT().FollowLogs(jobID, worker.LogStreamStderr).Return(logCh, func() {}, nil).Times(1)
+		streamClient, err := deps.client.FollowLogs(context.Background(), &servicepb.FollowLogsRequest{
+			JobId:  jobID,
+			Stream: servicepb.Stream_STREAM_STDERR,
+		})
+		require.NoError(t, err)
+
+		logResp, err := streamClient.Recv()
+		require.NoError(t, err)
+		require.Equal(t, "error", logResp.Log)
+		require.Equal(t, servicepb.Stream_STREAM_STDERR, logResp.Stream)
+		_, err = streamClient.Recv()
+		require.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("unknown stream", func(t *testing.T) {
+		logCh := make(chan worker.LogLine, 1)
+		logCh <- worker.LogLine{Stream: worker.LogStreamAll, Text: "legacy"}
+		close(logCh)
+		deps.mockWorker.EXPECT().FollowLogs(jobID, worker.LogStreamAll).Return(logCh, func() {}, nil).Times(1)
+		streamClient, err := deps.client.FollowLogs(context.Background(), &servicepb.FollowLogsRequest{JobId: jobID})
+		require.NoError(t, err)
+
+		logResp, err := streamClient.Recv()
+		require.NoError(t, err)
+		require.Equal(t, "legacy", logResp.Log)
+		require.Equal(t, servicepb.Stream_STREAM_UNSPECIFIED, logResp.Stream)
+	})
+
+	t.Run("unsupported stream", func(t *testing.T) {
+		streamClient, err := deps.client.FollowLogs(context.Background(), &servicepb.FollowLogsRequest{
+			JobId:  jobID,
+			Stream: servicepb.Stream(100),
+		})
+		require.NoError(t, err)
+		_, err = streamClient.Recv()
+		s, _ := status.FromError(err)
+		require.Equal(t, codes.InvalidArgument, s.Code())
+	})
+}
+
 func TestService_StopJob(t *testing.T) {
 	deps := setup(t, RootClientCertFile, RootClientKeyFile)
 	defer deps.close()
 	jobID := "job-id"
-	deps.mockWorker.EXPECT().StopJob(gomock.Any()).Return(nil).Times(1)
+	deps.mockWorker.EXPECT().DescribeJob(jobID).Return(jobSummary(jobID, "root"), nil).Times(1)
+	deps.mockWorker.EXPECT().StopJob(jobID, worker.StopOptions{}).Return(nil).Times(1)
 	_, err := deps.client.Stop(context.Background(), &servicepb.StopRequest{JobId: jobID})
 	require.NoError(t, err)
 }
 
+func TestService_StopJobSignal(t *testing.T) {
+	deps := setup(t, RootClientCertFile, RootClientKeyFile)
+	defer deps.close()
+	jobID := "job-id"
+	deps.mockWorker.EXPECT().DescribeJob(jobID).Return(jobSummary(jobID, "root"), nil).AnyTimes()
+
+	t.Run("signal and grace period", func(t *testing.T) {
+		wantOpts := worker.StopOptions{Signal: syscall.SIGINT, GracePeriod: 2 * time.Second}
+		deps.mockWorker.EXPECT().StopJob(jobID, wantOpts).Return(nil).Times(1)
+		_, err := deps.client.Stop(context.Background(), &servicepb.StopRequest{
+			JobId:         jobID,
+			Signal:        servicepb.Signal_SIGNAL_SIGINT,
+			GracePeriodMs: 2000,
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("negative grace period", func(t *testing.T) {
+		_, err := deps.client.Stop(context.Background(), &servicepb.StopRequest{JobId: jobID, GracePeriodMs: -1})
+		s, _ := status.FromError(err)
+		require.Equal(t, codes.InvalidArgument, s.Code())
+	})
+
+	t.Run("unsupported signal", func(t *testing.T) {
+		_, err := deps.client.Stop(context.Background(), &servicepb.StopRequest{JobId: jobID, Signal: 100})
+		s, _ := status.FromError(err)
+		require.Equal(t, codes.InvalidArgument, s.Code())
+	})
+}
+
+func TestService_QueryJobTermination(t *testing.T) {
+	deps := setup(t, RootClientCertFile, RootClientKeyFile)
+	defer deps.close()
+	startTime := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	wantJobStatus := worker.JobStatus{
+		State:     worker.JobStateTimedOut,
+		ExitCode:  -1,
+		ExitError: errors.New("signal: killed"),
+		Signal:    syscall.SIGKILL,
+		StartTime: startTime,
+		EndTime:   startTime.Add(time.Minute),
+	}
+	deps.mockWorker.EXPECT().DescribeJob(gomock.Any()).Return(worker.JobSummary{Metadata: worker.Metadata{Domain: DefaultDomain}, Status: wantJobStatus}, nil).Times(1)
+	queryResp, err := deps.client.Query(context.Background(), &servicepb.QueryRequest{JobId: "job-id"})
+	require.NoError(t, err)
+	require.Equal(t, servicepb.State_STATE_TIMED_OUT, queryResp.JobStatus.State)
+	require.Equal(t, servicepb.Signal_SIGNAL_SIGKILL, queryResp.JobStatus.Signal)
+	require.Equal(t, int64(-1), queryResp.JobStatus.ExitCode)
+	require.Equal(t, "signal: killed", queryResp.JobStatus.Error)
+	require.Equal(t, startTime, queryResp.JobStatus.StartTime.AsTime())
+	require.Equal(t, startTime.Add(time.Minute), queryResp.JobStatus.EndTime.AsTime())
+}
+
+func TestService_QueryJobStates(t *testing.T) {
+	deps := setup(t, RootClientCertFile, RootClientKeyFile)
+	defer deps.close()
+
+	for state, wantState := range states {
+		deps.mockWorker.EXPECT().DescribeJob(gomock.Any()).Return(worker.JobSummary{Metadata: worker.Metadata{Domain: DefaultDomain}, Status: worker.JobStatus{State: state}}, nil).Times(1)
+		queryResp, err := deps.client.Query(context.Background(), &servicepb.QueryRequest{JobId: "job-id"})
+		require.NoError(t, err)
+		require.Equal(t, wantState, queryResp.JobStatus.State)
+		require.Nil(t, queryResp.JobStatus.StartTime)
+	}
+	require.Len(t, states, len(servicepb.State_name), "every state is mapped")
+}
+
+func TestService_StopJobs(t *testing.T) {
+	deps := setup(t, RootClientCertFile, RootClientKeyFile)
+	defer deps.close()
+
+	t.Run("stop matching jobs", func(t *testing.T) {
+		selector, err := worker.ParseSelector("team=infra")
+		require.NoError(t, err)
+		wantOpts := worker.StopOptions{Signal: syscall.SIGINT}
+		deps.mockWorker.EXPECT().StopJobs(worker.JobFilter{Domain: DefaultDomain, Selector: selector}, wantOpts).Return([]string{"1", "2"}, nil).Times(1)
+		resp, err := deps.client.StopJobs(context.Background(), &servicepb.StopJobsRequest{
+			LabelSelector: "team=infra",
+			Signal:        servicepb.Signal_SIGNAL_SIGINT,
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"1", "2"}, resp.JobIds)
+	})
+
+	t.Run("partial failure", func(t *testing.T) {
+		stopErr := errors.Join(
+			&worker.StopJobError{JobID: "3", Err: errors.New("some error")},
+			&worker.StopJobError{JobID: "4", Err: worker.ErrorJobNotStarted},
+		)
+		deps.mockWorker.EXPECT().StopJobs(gomock.Any(), gomock.Any()).Return([]string{"1", "2"}, stopErr).Times(1)
+		resp, err := deps.client.StopJobs(context.Background(), &servicepb.StopJobsRequest{LabelSelector: "team=infra"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"1", "2"}, resp.JobIds)
+		require.Equal(t, []string{"3", "4"}, resp.FailedJobIds)
+	})
+
+	t.Run("unexpected error", func(t *testing.T) {
+		deps.mockWorker.EXPECT().StopJobs(gomock.Any(), gomock.Any()).Return(nil, errors.New("some error")).Times(1)
+		_, err := deps.client.StopJobs(context.Background(), &servicepb.StopJobsRequest{LabelSelector: "team=infra"})
+		require.Equal(t, codes.Internal, status.Code(err))
+	})
+
+	t.Run("selector required", func(t *testing.T) {
+		_, err := deps.client.StopJobs(context.Background(), &servicepb.StopJobsRequest{})
+		s, _ := status.FromError(err)
+		require.Equal(t, codes.InvalidArgument, s.Code())
+	})
+}
+
+func TestService_StopJobNotStarted(t *testing.T) {
+	deps := setup(t, RootClientCertFile, RootClientKeyFile)
+	defer deps.close()
+	deps.mockWorker.EXPECT().DescribeJob("job-id").Return(jobSummary("job-id", "root"), nil).Times(1)
+	deps.mockWorker.EXPECT().StopJob(gomock.Any(), gomock.Any()).Return(worker.ErrorJobNotStarted).Times(1)
+	_, err := deps.client.Stop(context.Background(), &servicepb.StopRequest{JobId: "job-id"})
+	s, _ := status.FromError(err)
+	require.Equal(t, codes.FailedPrecondition, s.Code())
+}
+
+func TestService_DeleteJob(t *testing.T) {
+	deps := setup(t, RootClientCertFile, RootClientKeyFile)
+	defer deps.close()
+
+	t.Run("completed job", func(t *testing.T) {
+		deps.mockWorker.EXPECT().DeleteJob("job-id", gomock.Any()).DoAndReturn(mockDeleteJob(jobSummary("job-id", "root"), 42, nil)).Times(1)
+		resp, err := deps.client.DeleteJob(context.Background(), &servicepb.DeleteJobRequest{JobId: "job-id"})
+		require.NoError(t, err)
+		require.Equal(t, int64(42), resp.ReclaimedBytes)
+	})
+
+	t.Run("running job", func(t *testing.T) {
+		deps.mockWorker.EXPECT().DeleteJob("job-id", gomock.Any()).DoAndReturn(mockDeleteJob(jobSummary("job-id", "root"), 0, worker.ErrorJobNotCompleted)).Times(1)
+		_, err := deps.client.DeleteJob(context.Background(), &servicepb.DeleteJobRequest{JobId: "job-id"})
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	})
+
+	t.Run("job not found", func(t *testing.T) {
+		deps.mockWorker.EXPECT().DeleteJob("job-id", gomock.Any()).Return(int64(0), worker.ErrorJobNotFound).Times(1)
+		_, err := deps.client.DeleteJob(context.Background(), &servicepb.DeleteJobRequest{JobId: "job-id"})
+		require.Equal(t, codes.NotFound, status.Code(err))
+	})
+}
+
+func TestService_DeleteJobPermissionDenied(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr string
+	}{
+		{
+			name:    "default policy",
+			policy:  ACLPolicyFile,
+			wantErr: "nobody not permitted to purge on jobs/root/job-id",
+		},
+		{
+			// Stopping jobs does not permit purging them
+			name:    "delete permitted",
+			policy:  "p, nobody, *, *, delete\n",
+			wantErr: "nobody not permitted to purge on jobs/root/job-id",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policyFile := tt.policy
+			if policyFile != ACLPolicyFile {
+				policyFile = filepath.Join(t.TempDir(), "policy.csv")
+				require.NoError(t, os.WriteFile(policyFile, []byte(tt.policy), 0600))
+			}
+			deps := setupWithPolicy(t, NobodyClientCertFile, NobodyClientKeyFile, policyFile)
+			defer deps.close()
+			deps.mockWorker.EXPECT().DeleteJob("job-id", gomock.Any()).DoAndReturn(mockDeleteJob(jobSummary("job-id", "root"), 42, nil)).Times(1)
+			_, err := deps.client.DeleteJob(context.Background(), &servicepb.DeleteJobRequest{JobId: "job-id"})
+			s, _ := status.FromError(err)
+			require.Equal(t, codes.PermissionDenied, s.Code())
+			require.Equal(t, tt.wantErr, s.Message())
+		})
+	}
+}
+
+// mockDeleteJob returns a worker DeleteJob that authorizes the job before
+// returning the reclaimed bytes and error.
+func mockDeleteJob(job worker.JobSummary, reclaimed int64, err error) func(string, func(worker.JobSummary) error) (int64, error) {
+	return func(_ string, authorize func(worker.JobSummary) error) (int64, error) {
+		if authErr := authorize(job); authErr != nil {
+			return 0, authErr
+		}
+		return reclaimed, err
+	}
+}
+
 func TestService_jobNotFoundError(t *testing.T) {
 	deps := setup(t, RootClientCertFile, RootClientKeyFile)
 	defer deps.close()
-	deps.mockWorker.EXPECT().QueryJob(gomock.Any()).Return(worker.JobStatus{}, ErrorJobNotFound)
-	deps.mockWorker.EXPECT().StopJob(gomock.Any()).Return(ErrorJobNotFound)
-	deps.mockWorker.EXPECT().FollowLogs(gomock.Any()).Return(nil, nil, ErrorJobNotFound)
+	deps.mockWorker.EXPECT().DescribeJob(gomock.Any()).Return(worker.JobSummary{}, worker.ErrorJobNotFound).Times(3)
 	ctx := context.Background()
 
 	tests := []struct {
@@ -142,26 +658,31 @@ func TestService_insecureCredentials(t *testing.T) {
 func TestService_unauthorized(t *testing.T) {
 	deps := setup(t, NobodyClientCertFile, NobodyClientKeyFile)
 	defer deps.close()
+	deps.mockWorker.EXPECT().DescribeJob(gomock.Any()).Return(worker.JobSummary{}, worker.ErrorJobNotFound).AnyTimes()
 	ctx := context.Background()
 
 	tests := []struct {
 		name   string
 		rpc    func() (any, error)
 		action string
+		object string
 	}{
 		{
 			name:   "start unauthorized",
 			action: createAction,
+			object: objectWildcard,
 			rpc:    func() (any, error) { return deps.client.Start(ctx, &servicepb.StartRequest{}) },
 		},
 		{
 			name:   "query unauthorized",
 			action: readAction,
+			object: objectWildcard,
 			rpc:    func() (any, error) { return deps.client.Query(ctx, &servicepb.QueryRequest{}) },
 		},
 		{
 			name:   "follow unauthorized",
 			action: readAction,
+			object: objectWildcard,
 			rpc: func() (any, error) {
 				streamClient, err := deps.client.FollowLogs(ctx, &servicepb.FollowLogsRequest{})
 				assert.NoError(t, err)
@@ -171,8 +692,23 @@ func TestService_unauthorized(t *testing.T) {
 		{
 			name:   "stop unauthorized",
 			action: deleteAction,
+			object: objectWildcard,
 			rpc:    func() (any, error) { return deps.client.Stop(ctx, &servicepb.StopRequest{}) },
 		},
+		{
+			name:   "stop jobs of other owner unauthorized",
+			action: deleteAction,
+			object: "jobs/root/*",
+			rpc: func() (any, error) {
+				return deps.client.StopJobs(ctx, &servicepb.StopJobsRequest{LabelSelector: "team=infra", Owner: "root"})
+			},
+		},
+		{
+			name:   "list jobs of other owner unauthorized",
+			action: readAction,
+			object: "jobs/root/*",
+			rpc:    func() (any, error) { return deps.client.ListJobs(ctx, &servicepb.ListJobsRequest{Owner: "root"}) },
+		},
 	}
 
 	for _, tt := range tests {
@@ -180,11 +716,268 @@ func TestService_unauthorized(t *testing.T) {
 			_, err := tt.rpc()
 			s, _ := status.FromError(err)
 			assert.Equal(t, codes.PermissionDenied, s.Code())
-			assert.Equal(t, fmt.Sprintf("nobody not permitted to %s on *", tt.action), s.Message())
+			assert.Equal(t, fmt.Sprintf("nobody not permitted to %s on %s", tt.action, tt.object), s.Message())
+		})
+	}
+}
+
+func TestService_ownerAuthorization(t *testing.T) {
+	deps := setup(t, NobodyClientCertFile, NobodyClientKeyFile)
+	defer deps.close()
+	ctx := context.Background()
+
+	ownJob := jobSummary("own", "nobody")
+	otherJob := jobSummary("other", "root")
+	deps.mockWorker.EXPECT().DescribeJob(ownJob.ID).Return(ownJob, nil).AnyTimes()
+	deps.mockWorker.EXPECT().DescribeJob(otherJob.ID).Return(otherJob, nil).AnyTimes()
+
+	t.Run("query own job", func(t *testing.T) {
+		resp, err := deps.client.Query(ctx, &servicepb.QueryRequest{JobId: ownJob.ID})
+		require.NoError(t, err)
+		require.Equal(t, "nobody", resp.Owner)
+	})
+
+	t.Run("stop own job", func(t *testing.T) {
+		deps.mockWorker.EXPECT().StopJob(ownJob.ID, gomock.Any()).Return(nil).Times(1)
+		_, err := deps.client.Stop(ctx, &servicepb.StopRequest{JobId: ownJob.ID})
+		require.NoError(t, err)
+	})
+
+	t.Run("delete own job", func(t *testing.T) {
+		deps.mockWorker.EXPECT().DeleteJob(ownJob.ID, gomock.Any()).DoAndReturn(mockDeleteJob(ownJob, 42, nil)).Times(1)
+		_, err := deps.client.DeleteJob(ctx, &servicepb.DeleteJobRequest{JobId: ownJob.ID})
+		require.NoError(t, err)
+	})
+
+	t.Run("stop job of other owner", func(t *testing.T) {
+		_, err := deps.client.Stop(ctx, &servicepb.StopRequest{JobId: otherJob.ID})
+		s, _ := status.FromError(err)
+		require.Equal(t, codes.PermissionDenied, s.Code())
+		require.Equal(t, "nobody not permitted to delete on jobs/root/other", s.Message())
+	})
+
+	t.Run("list own jobs", func(t *testing.T) {
+		wantOpts := worker.ListOptions{JobFilter: worker.JobFilter{Owner: "nobody", Domain: DefaultDomain}}
+		deps.mockWorker.EXPECT().ListJobs(wantOpts).Return(worker.JobList{}, nil).Times(1)
+		_, err := deps.client.ListJobs(ctx, &servicepb.ListJobsRequest{})
+		require.NoError(t, err)
+	})
+
+	t.Run("stop own jobs in bulk", func(t *testing.T) {
+		deps.mockWorker.EXPECT().StopJobs(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(filter worker.JobFilter, _ worker.StopOptions) ([]string, error) {
+				require.Equal(t, "nobody", filter.Owner)
+				return []string{ownJob.ID}, nil
+			}).Times(1)
+		_, err := deps.client.StopJobs(ctx, &servicepb.StopJobsRequest{LabelSelector: "team=infra"})
+		require.NoError(t, err)
+	})
+
+	for _, owner := range []string{"nobody/*", "nobody/root", "*"} {
+		t.Run("list jobs of owner "+owner, func(t *testing.T) {
+			_, err := deps.client.ListJobs(ctx, &servicepb.ListJobsRequest{Owner: owner})
+			require.Equal(t, codes.PermissionDenied, status.Code(err))
+		})
+	}
+}
+
+func TestService_domainRoles(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.csv")
+	policy := "p, viewer, *, *, read\np, owner, *, jobs/*, read\ng, nobody, viewer, research\n"
+	require.NoError(t, os.WriteFile(policyFile, []byte(policy), 0600))
+
+	deps := setupWithPolicy(t, NobodyClientCertFile, NobodyClientKeyFile, policyFile)
+	defer deps.close()
+	research := metadata.AppendToOutgoingContext(context.Background(), DomainMetadataKey, "research")
+
+	t.Run("role permits action in domain", func(t *testing.T) {
+		wantOpts := worker.ListOptions{JobFilter: worker.JobFilter{Owner: "root", Domain: "research"}}
+		deps.mockWorker.EXPECT().ListJobs(wantOpts).Return(worker.JobList{}, nil).Times(1)
+		_, err := deps.client.ListJobs(research, &servicepb.ListJobsRequest{Owner: "root"})
+		require.NoError(t, err)
+	})
+
+	t.Run("role does not permit other actions", func(t *testing.T) {
+		_, err := deps.client.Start(research, &servicepb.StartRequest{})
+		s, _ := status.FromError(err)
+		require.Equal(t, codes.PermissionDenied, s.Code())
+	})
+
+	t.Run("role does not apply in other domains", func(t *testing.T) {
+		_, err := deps.client.ListJobs(context.Background(), &servicepb.ListJobsRequest{Owner: "root"})
+		s, _ := status.FromError(err)
+		require.Equal(t, codes.PermissionDenied, s.Code())
+		require.Equal(t, "nobody not permitted to read on jobs/root/*", s.Message())
+	})
+
+	t.Run("jobs of other domains are not found", func(t *testing.T) {
+		deps.mockWorker.EXPECT().DescribeJob("job-id").Return(jobSummary("job-id", "root"), nil).Times(1)
+		_, err := deps.client.Query(research, &servicepb.QueryRequest{JobId: "job-id"})
+		require.EqualError(t, err, ErrorJobNotFound.Error())
+	})
+}
+
+func TestService_GetPermissions(t *testing.T) {
+	t.Run("own permissions", func(t *testing.T) {
+		deps := setup(t, RootClientCertFile, RootClientKeyFile)
+		defer deps.close()
+		resp, err := deps.client.GetPermissions(context.Background(), &servicepb.GetPermissionsRequest{})
+		require.NoError(t, err)
+		require.Equal(t, []string{"admin"}, resp.Roles)
+		require.Contains(t, resp.Permissions, &servicepb.Permission{Role: "admin", Domain: "*", Object: "*", Action: createAction})
+		require.Contains(t, resp.Permissions, &servicepb.Permission{Role: "owner", Domain: "*", Object: "jobs/*", Action: readAction})
+	})
+
+	t.Run("permissions of other subject", func(t *testing.T) {
+		deps := setup(t, RootClientCertFile, RootClientKeyFile)
+		defer deps.close()
+		resp, err := deps.client.GetPermissions(context.Background(), &servicepb.GetPermissionsRequest{Subject: "nobody", Domain: "research"})
+		require.NoError(t, err)
+		require.Empty(t, resp.Roles)
+		require.Equal(t, []*servicepb.Permission{
+			{Role: "owner", Domain: "*", Object: "jobs/*", Action: readAction},
+			{Role: "owner", Domain: "*", Object: "jobs/*", Action: deleteAction},
+			{Role: "owner", Domain: "*", Object: "jobs/*", Action: purgeAction},
+		}, resp.Permissions)
+	})
+
+	t.Run("permissions of other subject unauthorized", func(t *testing.T) {
+		deps := setup(t, NobodyClientCertFile, NobodyClientKeyFile)
+		defer deps.close()
+		_, err := deps.client.GetPermissions(context.Background(), &servicepb.GetPermissionsRequest{Subject: "root"})
+		s, _ := status.FromError(err)
+		require.Equal(t, codes.PermissionDenied, s.Code())
+		require.Equal(t, "nobody not permitted to inspect on acl", s.Message())
+	})
+}
+
+func TestService_StartJobCommandPolicy(t *testing.T) {
+	commandsFile := filepath.Join(t.TempDir(), "commands.yaml")
+	commands := `
+Rules:
+  - Name: no-rm
+    Subjects: [admin]
+    Path: /bin/rm
+    Args: ["**"]
+    Deny: true
+  - Name: echo
+    Subjects: [admin]
+    Path: /bin/echo
+    Args: ["hello", "**"]
+  - Name: sleep
+    Subjects: [root]
+    Path: /bin/sleep
+    Args: ["[0-9]*"]
+`
+	require.NoError(t, os.WriteFile(commandsFile, []byte(commands), 0600))
+	commandPolicy, err := auth.LoadCommandPolicy(commandsFile)
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	mockWorker := NewMockWorker(ctrl)
+	srv := newServerWithService(t, &Service{
+		worker:     mockWorker,
+		authorizer: auth.New(ACLModelFile, ACLPolicyFile),
+		commands:   commandPolicy,
+	})
+	client, conn := newClient(t, RootClientCertFile, RootClientKeyFile)
+	deps := &dependencies{server: srv, client: client, clientConn: conn, mockWorker: mockWorker, ctrl: ctrl}
+	defer deps.close()
+
+	tests := []struct {
+		name       string
+		cmd        string
+		args       []string
+		env        []string
+		rootfs     string
+		bindMounts []string
+		wantErr    string
+	}{
+		{name: "permitted by role", cmd: "/bin/echo", args: []string{"hello", "world"}},
+		{name: "permitted by subject", cmd: "/bin/sleep", args: []string{"10"}},
+		{name: "denied by rule", cmd: "/bin/rm", args: []string{"-rf", "/"}, wantErr: `root not permitted to run /bin/rm: denied by command rule "no-rm"`},
+		{name: "arguments not permitted", cmd: "/bin/sleep", args: []string{"10", "20"}, wantErr: `root not permitted to run /bin/sleep: arguments, environment or filesystem not permitted by command rule "sleep"`},
+		{name: "environment not permitted", cmd: "/bin/sleep", args: []string{"10"}, env: []string{"LD_PRELOAD=/tmp/evil.so"}, wantErr: `root not permitted to run /bin/sleep: arguments, environment or filesystem not permitted by command rule "sleep"`},
+		{name: "root filesystem not permitted", cmd: "/bin/sleep", args: []string{"10"}, rootfs: "/tmp/rootfs", wantErr: `root not permitted to run /bin/sleep: arguments, environment or filesystem not permitted by command rule "sleep"`},
+		{name: "bind mounts not permitted", cmd: "/bin/sleep", args: []string{"10"}, bindMounts: []string{"/etc"}, wantErr: `root not permitted to run /bin/sleep: arguments, environment or filesystem not permitted by command rule "sleep"`},
+		{name: "relative command not permitted", cmd: "echo", args: []string{"hello"}, wantErr: `root not permitted to run echo: command not permitted by command rules "no-rm", "echo", "sleep"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr == "" {
+				deps.mockWorker.EXPECT().StartJob(gomock.Any(), gomock.Any()).Return(&worker.Job{ID: "1"}, nil).Times(1)
+			}
+			command := &servicepb.Command{Cmd: tt.cmd, Args: tt.args, Env: tt.env, Rootfs: tt.rootfs}
+			for _, source := range tt.bindMounts {
+				command.BindMounts = append(command.BindMounts, &servicepb.BindMount{Source: source, Target: source})
+			}
+			_, err := deps.client.Start(context.Background(), &servicepb.StartRequest{Command: command})
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			s, _ := status.FromError(err)
+			require.Equal(t, codes.PermissionDenied, s.Code())
+			require.Equal(t, tt.wantErr, s.Message())
 		})
 	}
 }
 
+func TestService_reloadACL(t *testing.T) {
+	dir := t.TempDir()
+	modelFile, policyFile := filepath.Join(dir, "model.conf"), filepath.Join(dir, "policy.csv")
+	model, err := os.ReadFile(ACLModelFile)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(modelFile, model, 0600))
+	require.NoError(t, os.WriteFile(policyFile, []byte("p, root, *, *, create\n"), 0600))
+
+	authorizer := auth.New(modelFile, policyFile)
+	reloads := make(chan error, 100)
+	unwatch, err := authorizer.Watch(func(_ string, _ []string, err error) { reloads <- err })
+	require.NoError(t, err)
+	defer unwatch()
+
+	ctrl := gomock.NewController(t)
+	mockWorker := NewMockWorker(ctrl)
+	mockWorker.EXPECT().StartJob(gomock.Any(), gomock.Any()).Return(&worker.Job{ID: "1"}, nil).AnyTimes()
+	srv := newServerWithService(t, &Service{worker: mockWorker, authorizer: authorizer})
+	client, conn := newClient(t, NobodyClientCertFile, NobodyClientKeyFile)
+	deps := &dependencies{server: srv, client: client, clientConn: conn, mockWorker: mockWorker, ctrl: ctrl}
+	defer deps.close()
+
+	start := func() error {
+		_, err := deps.client.Start(context.Background(), &servicepb.StartRequest{Command: &servicepb.Command{Cmd: "some-command"}})
+		return err
+	}
+	require.Equal(t, codes.PermissionDenied, status.Code(start()))
+
+	require.NoError(t, os.WriteFile(policyFile, []byte("p, nobody, *, *, create\n"), 0600))
+	require.Eventually(t, func() bool { return start() == nil }, 5*time.Second, 50*time.Millisecond)
+	// Files may be reloaded while they are written, so wait for the result of
+	// the last reload
+	waitReload := func(wantErr bool) {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case err := <-reloads:
+				if (err != nil) == wantErr {
+					return
+				}
+			case <-timeout:
+				require.Fail(t, "reload not reported", "want error: %t", wantErr)
+			}
+		}
+	}
+	waitReload(false)
+
+	// Invalid policies are not loaded
+	require.NoError(t, os.WriteFile(policyFile, []byte("p, root, create\n"), 0600))
+	require.Never(t, func() bool { return start() != nil }, time.Second, 50*time.Millisecond)
+	waitReload(true)
+	require.Error(t, authorizer.Reload())
+}
+
 type dependencies struct {
 	server     *Server
 	client     servicepb.ServiceClient
@@ -200,9 +993,13 @@ func (d *dependencies) close() {
 }
 
 func setup(t *testing.T, clientCert string, clientKey string) *dependencies {
+	return setupWithPolicy(t, clientCert, clientKey, ACLPolicyFile)
+}
+
+func setupWithPolicy(t *testing.T, clientCert string, clientKey string, policyFile string) *dependencies {
 	ctrl := gomock.NewController(t)
 	mockWorker := NewMockWorker(ctrl)
-	srv := newServer(t, mockWorker)
+	srv := newServerWithPolicy(t, mockWorker, policyFile)
 	client, conn := newClient(t, clientCert, clientKey)
 	return &dependencies{
 		server:     srv,
@@ -214,19 +1011,32 @@ func setup(t *testing.T, clientCert string, clientKey string) *dependencies {
 }
 
 func newServer(t *testing.T, worker Worker) *Server {
-	tlsCfg, err := newTLSConfig(auth.TypeServer, ServerCertFile, ServerKeyFile)
-	require.NoError(t, err)
+	return newServerWithPolicy(t, worker, ACLPolicyFile)
+}
 
-	service := &Service{
+func newServerWithPolicy(t *testing.T, worker Worker, policyFile string) *Server {
+	return newServerWithService(t, &Service{
 		worker:     worker,
-		authorizer: auth.New(ACLModelFile, ACLPolicyFile),
-	}
+		authorizer: auth.New(ACLModelFile, policyFile),
+	})
+}
 
-	srv, err := New(Config{
+func newServerWithService(t *testing.T, service *Service) *Server {
+	tlsCfg, err := newTLSConfig(auth.TypeServer, ServerCertFile, ServerKeyFile)
+	require.NoError(t, err)
+	return newServerWithTLS(t, service, tlsCfg)
+}
+
+func newServerWithTLS(t *testing.T, service *Service, tlsCfg *tls.Config) *Server {
+	return newServerWithConfig(t, Config{
 		Address: rpcAddr.String(),
 		Service: service,
 		TLS:     tlsCfg,
 	})
+}
+
+func newServerWithConfig(t *testing.T, config Config) *Server {
+	srv, err := New(config)
 	require.NoError(t, err)
 
 	go func() {
@@ -255,11 +1065,19 @@ func newTLSConfig(tlsType auth.Type, certFile string, keyFile string) (*tls.Conf
 	})
 }
 
-func mockLogs(log string, num int) chan string {
-	logCh := make(chan string)
+// jobSummary describes a job of the owner in the default domain.
+func jobSummary(jobID string, owner string) worker.JobSummary {
+	return worker.JobSummary{
+		ID:       jobID,
+		Metadata: worker.Metadata{Owner: owner, Domain: DefaultDomain},
+	}
+}
+
+func mockLogs(log string, num int) chan worker.LogLine {
+	logCh := make(chan worker.LogLine)
 	go func() {
 		for i := 0; i < num; i++ {
-			logCh <- log
+			logCh <- worker.LogLine{Stream: worker.LogStreamStdout, Text: log}
 		}
 	}()
 	return logCh
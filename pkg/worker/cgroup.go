@@ -0,0 +1,117 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+const (
+	defaultCgroupRoot = "/sys/fs/cgroup"
+	defaultCPUPeriod  = 100 * time.Millisecond
+	maxCPUWeight      = 10000
+)
+
+var (
+	ErrorCgroupUnavailable = errors.New("cgroup v2 unavailable")
+	ErrorInvalidLimits     = errors.New("invalid resource limits")
+)
+
+var deviceRegexp = regexp.MustCompile(`^\d+:\d+$`)
+
+// ResourceLimits are applied to a job through a dedicated cgroup v2. Zero
+// values leave the corresponding limit unset.
+type ResourceLimits struct {
+	// CPUWeight is the relative share of CPU time in the range [1, 10000].
+	CPUWeight uint64
+	// CPUQuota is the CPU time the job may use in each CPUPeriod.
+	CPUQuota  time.Duration
+	CPUPeriod time.Duration
+	// MemoryMax is the memory usage hard limit in bytes.
+	MemoryMax int64
+	IOMax     []IOMax
+}
+
+// IOMax limits the IO of a job on a block device.
+type IOMax struct {
+	// Device is the block device number in the form "major:minor".
+	Device    string
+	ReadBPS   uint64
+	WriteBPS  uint64
+	ReadIOPS  uint64
+	WriteIOPS uint64
+}
+
+func (l ResourceLimits) validate() error {
+	if l.CPUWeight > maxCPUWeight {
+		return fmt.Errorf("%w: cpu weight must be between 1 and %d", ErrorInvalidLimits, maxCPUWeight)
+	}
+	if l.CPUQuota < 0 || l.CPUPeriod < 0 {
+		return fmt.Errorf("%w: cpu quota and period must not be negative", ErrorInvalidLimits)
+	}
+	if l.CPUPeriod != 0 && l.CPUQuota == 0 {
+		return fmt.Errorf("%w: cpu period requires a cpu quota", ErrorInvalidLimits)
+	}
+	if l.MemoryMax < 0 {
+		return fmt.Errorf("%w: memory max must not be negative", ErrorInvalidLimits)
+	}
+	for _, io := range l.IOMax {
+		if !deviceRegexp.MatchString(io.Device) {
+			return fmt.Errorf("%w: io device %q must be in the form major:minor", ErrorInvalidLimits, io.Device)
+		}
+	}
+	return nil
+}
+
+// controllers returns the cgroup v2 controllers required to enforce the limits.
+func (l ResourceLimits) controllers() []string {
+	var controllers []string
+	if l.CPUWeight != 0 || l.CPUQuota != 0 {
+		controllers = append(controllers, "cpu")
+	}
+	if l.MemoryMax != 0 {
+		controllers = append(controllers, "memory")
+	}
+	if len(l.IOMax) > 0 {
+		controllers = append(controllers, "io")
+	}
+	return controllers
+}
+
+// files returns the cgroup interface files and the values to write to them.
+func (l ResourceLimits) files() map[string]string {
+	files := map[string]string{}
+	if l.CPUWeight != 0 {
+		files["cpu.weight"] = fmt.Sprintf("%d", l.CPUWeight)
+	}
+	if l.CPUQuota != 0 {
+		period := l.CPUPeriod
+		if period == 0 {
+			period = defaultCPUPeriod
+		}
+		files["cpu.max"] = fmt.Sprintf("%d %d", l.CPUQuota.Microseconds(), period.Microseconds())
+	}
+	if l.MemoryMax != 0 {
+		files["memory.max"] = fmt.Sprintf("%d", l.MemoryMax)
+	}
+	return files
+}
+
+func (io IOMax) String() string {
+	s := io.Device
+	for _, limit := range []struct {
+		key   string
+		value uint64
+	}{
+		{"rbps", io.ReadBPS},
+		{"wbps", io.WriteBPS},
+		{"riops", io.ReadIOPS},
+		{"wiops", io.WriteIOPS},
+	} {
+		if limit.value != 0 {
+			s += fmt.Sprintf(" %s=%d", limit.key, limit.value)
+		}
+	}
+	return s
+}
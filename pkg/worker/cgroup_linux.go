@@ -0,0 +1,218 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	cgroupParent        = "jobrunner"
+	cgroupServer        = "server"
+	cgroup2SuperMagic   = 0x63677270
+	cgroupRemoveTimeout = 5 * time.Second
+)
+
+type cgroup struct {
+	path string
+}
+
+// newCgroup creates the cgroup of a job below the jobrunner cgroup of the
+// cgroup v2 hierarchy mounted at root and applies the resource limits to it.
+func newCgroup(root string, name string, limits ResourceLimits) (*cgroup, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(root, &stat); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrorCgroupUnavailable, err)
+	}
+	if uint32(stat.Type) != cgroup2SuperMagic {
+		return nil, fmt.Errorf("%w: %s is not a cgroup v2 mount", ErrorCgroupUnavailable, root)
+	}
+
+	parent := filepath.Join(root, cgroupParent)
+	if err := enableControllers(root, parent, limits.controllers()); err != nil {
+		return nil, err
+	}
+
+	cg := &cgroup{
+		path: filepath.Join(parent, name),
+	}
+	if err := os.Mkdir(cg.path, 0755); err != nil {
+		return nil, err
+	}
+
+	if err := cg.setLimits(limits); err != nil {
+		if rmErr := os.Remove(cg.path); rmErr != nil {
+			return nil, fmt.Errorf("%v (error removing cgroup: %v)", err, rmErr)
+		}
+		return nil, err
+	}
+
+	return cg, nil
+}
+
+// enableControllers makes the controllers available to the cgroups created
+// below parent. Controllers must be delegated to root, but are enabled in its
+// subtree when possible. Controllers cannot be enabled in the subtree of a
+// cgroup that holds processes, which is the case of root when the worker runs
+// in a container with a private cgroup namespace, so the worker is then moved
+// into a leaf cgroup below parent.
+func enableControllers(root string, parent string, controllers []string) error {
+	available, err := readControllers(filepath.Join(root, "cgroup.controllers"))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrorCgroupUnavailable, err)
+	}
+
+	for _, controller := range controllers {
+		if !available[controller] {
+			return fmt.Errorf("%w: %s controller is not delegated to %s", ErrorCgroupUnavailable, controller, root)
+		}
+	}
+
+	if err = os.Mkdir(parent, 0755); err != nil && !os.IsExist(err) {
+		return err
+	}
+
+	for _, dir := range []string{root, parent} {
+		file := filepath.Join(dir, "cgroup.subtree_control")
+		enabled, err := readControllers(file)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrorCgroupUnavailable, err)
+		}
+		for _, controller := range controllers {
+			if enabled[controller] {
+				continue
+			}
+			err = writeFile(file, "+"+controller)
+			if errors.Is(err, syscall.EBUSY) && dir == root {
+				if err = moveToLeaf(root, parent); err != nil {
+					return fmt.Errorf("%w: error moving worker out of %s: %v", ErrorCgroupUnavailable, root, err)
+				}
+				err = writeFile(file, "+"+controller)
+			}
+			if errors.Is(err, syscall.EBUSY) {
+				return fmt.Errorf("%w: error enabling %s controller in %s: processes other than the worker must be moved out of %s", ErrorCgroupUnavailable, controller, file, dir)
+			}
+			if err != nil {
+				return fmt.Errorf("%w: error enabling %s controller in %s: %v", ErrorCgroupUnavailable, controller, file, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// moveToLeaf moves the worker process from root into the server cgroup below
+// parent when root holds it.
+func moveToLeaf(root string, parent string) error {
+	pids, err := (&cgroup{path: root}).pids()
+	if err != nil {
+		return err
+	}
+	pid := os.Getpid()
+	for _, p := range pids {
+		if p != pid {
+			continue
+		}
+		leaf := &cgroup{path: filepath.Join(parent, cgroupServer)}
+		if err = os.Mkdir(leaf.path, 0755); err != nil && !os.IsExist(err) {
+			return err
+		}
+		return leaf.addProcess(pid)
+	}
+	return nil
+}
+
+func (c *cgroup) setLimits(limits ResourceLimits) error {
+	for name, value := range limits.files() {
+		if err := writeFile(filepath.Join(c.path, name), value); err != nil {
+			return err
+		}
+	}
+	for _, io := range limits.IOMax {
+		if err := writeFile(filepath.Join(c.path, "io.max"), io.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *cgroup) addProcess(pid int) error {
+	return writeFile(filepath.Join(c.path, "cgroup.procs"), strconv.Itoa(pid))
+}
+
+// kill sends SIGKILL to every process in the cgroup.
+func (c *cgroup) kill() error {
+	if err := writeFile(filepath.Join(c.path, "cgroup.kill"), "1"); err == nil {
+		return nil
+	}
+
+	// cgroup.kill is only available since Linux 5.14
+	pids, err := c.pids()
+	if err != nil {
+		return err
+	}
+	for _, pid := range pids {
+		if err = syscall.Kill(pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+			return err
+		}
+	}
+	return nil
+}
+
+// remove kills any processes left in the cgroup and removes it.
+func (c *cgroup) remove() error {
+	if err := c.kill(); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(cgroupRemoveTimeout)
+	for {
+		err := os.Remove(c.path)
+		if err == nil || os.IsNotExist(err) {
+			return nil
+		}
+		if !errors.Is(err, syscall.EBUSY) || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (c *cgroup) pids() ([]int, error) {
+	data, err := os.ReadFile(filepath.Join(c.path, "cgroup.procs"))
+	if err != nil {
+		return nil, err
+	}
+
+	var pids []int
+	for _, field := range strings.Fields(string(data)) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+func readControllers(file string) (map[string]bool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	controllers := map[string]bool{}
+	for _, controller := range strings.Fields(string(data)) {
+		controllers[controller] = true
+	}
+	return controllers, nil
+}
+
+func writeFile(file string, value string) error {
+	return os.WriteFile(file, []byte(value), 0)
+}
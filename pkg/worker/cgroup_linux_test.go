@@ -0,0 +1,130 @@
+package worker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCgroup_notCgroup2(t *testing.T) {
+	_, err := newCgroup(t.TempDir(), "job", ResourceLimits{})
+	require.ErrorIs(t, err, ErrorCgroupUnavailable)
+}
+
+func TestJob_cgroup(t *testing.T) {
+	root := cgroup2Root(t)
+	// Jobs are put in a cgroup even without limits
+	cmd := Command{
+		Cmd:  "cat",
+		Args: []string{"/proc/self/cgroup"},
+	}
+
+	job, err := NewJob(cmd, t.TempDir(), WithCgroupRoot(root))
+	require.NoError(t, err)
+	require.NoError(t, job.Start())
+	if job.cgroup == nil {
+		job.Wait()
+		t.Skip("job cgroup unavailable")
+	}
+
+	logs := readLogs(t, job)
+	require.Contains(t, logs, fmt.Sprintf("0::/%s/%s", cgroupParent, job.ID))
+	require.Equal(t, 0, job.Status.ExitCode)
+
+	_, err = os.Stat(job.cgroup.path)
+	require.True(t, os.IsNotExist(err), "job cgroup should be removed")
+}
+
+func TestJob_cgroupLimits(t *testing.T) {
+	root := cgroup2Root(t)
+	limits := ResourceLimits{
+		CPUQuota:  50 * time.Millisecond,
+		MemoryMax: 64 << 20,
+	}
+	want := map[string]string{
+		"cpu.max":    "50000 100000",
+		"memory.max": "67108864",
+	}
+	if device := blockDevice(t); device != "" {
+		limits.IOMax = []IOMax{{Device: device, ReadBPS: 1 << 20}}
+	}
+
+	available, err := readControllers(filepath.Join(root, "cgroup.controllers"))
+	require.NoError(t, err)
+	for _, controller := range limits.controllers() {
+		if controller == "io" && !available[controller] {
+			limits.IOMax = nil
+			continue
+		}
+		if !available[controller] {
+			t.Skipf("%s controller is not delegated to %s", controller, root)
+		}
+	}
+
+	cmd := Command{
+		Cmd:    "sleep",
+		Args:   []string{"60"},
+		Limits: &limits,
+	}
+	job, err := NewJob(cmd, t.TempDir(), WithCgroupRoot(root))
+	require.NoError(t, err)
+	require.NoError(t, job.Start())
+	defer job.Stop(StopOptions{GracePeriod: 100 * time.Millisecond})
+
+	enabled, err := readControllers(filepath.Join(root, cgroupParent, "cgroup.subtree_control"))
+	require.NoError(t, err)
+	for _, controller := range limits.controllers() {
+		require.True(t, enabled[controller], "%s controller should be enabled", controller)
+	}
+
+	for name, value := range want {
+		data, err := os.ReadFile(filepath.Join(job.cgroup.path, name))
+		require.NoError(t, err)
+		require.Equal(t, value, strings.TrimSpace(string(data)), name)
+	}
+	if len(limits.IOMax) > 0 {
+		data, err := os.ReadFile(filepath.Join(job.cgroup.path, "io.max"))
+		require.NoError(t, err)
+		require.Contains(t, string(data), limits.IOMax[0].Device+" rbps=1048576")
+	}
+
+	pids, err := job.cgroup.pids()
+	require.NoError(t, err)
+	require.Contains(t, pids, job.pid)
+}
+
+// blockDevice returns the number of a block device of the host, or an empty
+// string if there is none.
+func blockDevice(t *testing.T) string {
+	devices, err := filepath.Glob("/sys/block/*/dev")
+	require.NoError(t, err)
+	for _, device := range devices {
+		if strings.Contains(device, "/loop") || strings.Contains(device, "/ram") {
+			continue
+		}
+		data, err := os.ReadFile(device)
+		require.NoError(t, err)
+		return strings.TrimSpace(string(data))
+	}
+	return ""
+}
+
+// cgroup2Root returns the mount point of the cgroup v2 hierarchy, which is
+// /sys/fs/cgroup/unified on hosts in hybrid mode.
+func cgroup2Root(t *testing.T) string {
+	data, err := os.ReadFile("/proc/self/mounts")
+	require.NoError(t, err)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 2 && fields[2] == "cgroup2" {
+			return fields[1]
+		}
+	}
+	t.Skip("no cgroup v2 mount")
+	return ""
+}
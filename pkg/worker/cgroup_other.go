@@ -0,0 +1,25 @@
+//go:build !linux
+
+package worker
+
+import "fmt"
+
+type cgroup struct {
+	path string
+}
+
+func newCgroup(string, string, ResourceLimits) (*cgroup, error) {
+	return nil, fmt.Errorf("%w: cgroups are only supported on linux", ErrorCgroupUnavailable)
+}
+
+func (c *cgroup) addProcess(int) error {
+	return nil
+}
+
+func (c *cgroup) kill() error {
+	return nil
+}
+
+func (c *cgroup) remove() error {
+	return nil
+}
@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceLimits_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  ResourceLimits
+		wantErr bool
+	}{
+		{
+			name:   "no limits",
+			limits: ResourceLimits{},
+		},
+		{
+			name: "all limits",
+			limits: ResourceLimits{
+				CPUWeight: 100,
+				CPUQuota:  50 * time.Millisecond,
+				CPUPeriod: 100 * time.Millisecond,
+				MemoryMax: 64 << 20,
+				IOMax:     []IOMax{{Device: "8:0", ReadBPS: 1 << 20}},
+			},
+		},
+		{
+			name:    "cpu weight out of range",
+			limits:  ResourceLimits{CPUWeight: maxCPUWeight + 1},
+			wantErr: true,
+		},
+		{
+			name:    "cpu period without quota",
+			limits:  ResourceLimits{CPUPeriod: time.Second},
+			wantErr: true,
+		},
+		{
+			name:    "negative memory max",
+			limits:  ResourceLimits{MemoryMax: -1},
+			wantErr: true,
+		},
+		{
+			name:    "invalid io device",
+			limits:  ResourceLimits{IOMax: []IOMax{{Device: "/dev/sda"}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.limits.validate()
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrorInvalidLimits)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestResourceLimits_files(t *testing.T) {
+	limits := ResourceLimits{
+		CPUWeight: 200,
+		CPUQuota:  50 * time.Millisecond,
+		MemoryMax: 1024,
+		IOMax:     []IOMax{{Device: "8:0", ReadBPS: 10, WriteIOPS: 20}},
+	}
+
+	require.Equal(t, []string{"cpu", "memory", "io"}, limits.controllers())
+	require.Equal(t, map[string]string{
+		"cpu.weight": "200",
+		"cpu.max":    "50000 100000",
+		"memory.max": "1024",
+	}, limits.files())
+	require.Equal(t, "8:0 rbps=10 wiops=20", limits.IOMax[0].String())
+}
@@ -0,0 +1,21 @@
+package worker
+
+import "syscall"
+
+// Credential is the user and groups a job runs as.
+type Credential struct {
+	UID    uint32   `json:"uid"`
+	GID    uint32   `json:"gid"`
+	Groups []uint32 `json:"groups,omitempty"`
+}
+
+func (c *Credential) sys() *syscall.Credential {
+	if c == nil {
+		return nil
+	}
+	return &syscall.Credential{
+		Uid:    c.UID,
+		Gid:    c.GID,
+		Groups: c.Groups,
+	}
+}
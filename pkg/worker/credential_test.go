@@ -0,0 +1,84 @@
+package worker
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJob_runAs(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing credentials requires root")
+	}
+
+	const idCmd = "id -u; id -g; id -G"
+
+	tests := []struct {
+		name     string
+		runAs    *Credential
+		opts     []Option
+		wantLogs []string
+	}{
+		{
+			name:     "command credential",
+			runAs:    &Credential{UID: 65534, GID: 65534, Groups: []uint32{65533}},
+			wantLogs: []string{"65534", "65534", "65534 65533"},
+		},
+		{
+			name:     "default credential",
+			opts:     []Option{WithDefaultCredential(Credential{UID: 65533, GID: 65533})},
+			wantLogs: []string{"65533", "65533", "65533"},
+		},
+		{
+			name:     "command overrides default credential",
+			runAs:    &Credential{UID: 65534, GID: 65534},
+			opts:     []Option{WithDefaultCredential(Credential{UID: 65533, GID: 65533})},
+			wantLogs: []string{"65534", "65534", "65534"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job, err := NewJob(Command{Cmd: "sh", Args: []string{"-c", idCmd}, RunAs: tt.runAs}, t.TempDir(), tt.opts...)
+			require.NoError(t, err)
+			require.NoError(t, job.Start())
+			require.Equal(t, tt.wantLogs, readLogs(t, job))
+		})
+	}
+}
+
+func TestJob_artifacts(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing credentials requires root")
+	}
+
+	// The job must be able to search the log directory and its parent
+	logDir := t.TempDir()
+	require.NoError(t, os.Chmod(logDir, 0711))
+	require.NoError(t, os.Chmod(filepath.Dir(logDir), 0711))
+
+	cmd := Command{
+		Cmd:   "sh",
+		Args:  []string{"-c", `id -u > "$JOBRUNNER_ARTIFACTS/uid"`},
+		RunAs: &Credential{UID: 65534, GID: 65534},
+	}
+	job, err := NewJob(cmd, logDir)
+	require.NoError(t, err)
+	require.NoError(t, job.Start())
+	job.Wait()
+	require.Equal(t, 0, job.Status.ExitCode)
+
+	artifacts := filepath.Join(job.dir, artifactsDirName)
+	info, err := os.Stat(artifacts)
+	require.NoError(t, err)
+	stat := info.Sys().(*syscall.Stat_t)
+	require.Equal(t, uint32(65534), stat.Uid)
+	require.Equal(t, uint32(65534), stat.Gid)
+
+	data, err := os.ReadFile(filepath.Join(artifacts, "uid"))
+	require.NoError(t, err)
+	require.Equal(t, "65534\n", string(data))
+}
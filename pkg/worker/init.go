@@ -0,0 +1,198 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// initProcessName is the argv[0] a Worker uses when it re-executes the current
+// binary to act as the init process of a job.
+const initProcessName = "jobrunner-init"
+
+// File descriptors of the pipes handed to the init process via ExtraFiles.
+const (
+	initConfigFD = 3
+	initStatusFD = 4
+	// initExitFD is a file the exit status of the command is also written to,
+	// as the status pipe is broken if the worker exits first.
+	initExitFD = 5
+)
+
+// outputDrainTimeout is how long the init process waits for the rest of the
+// output of the command once it exits, which descendants left running may
+// hold open.
+const outputDrainTimeout = time.Second
+
+type initConfig struct {
+	Cmd        string      `json:"cmd"`
+	Args       []string    `json:"args"`
+	Hostname   string      `json:"hostname"`
+	Isolation  *Isolation  `json:"isolation,omitempty"`
+	RootFS     string      `json:"rootfs,omitempty"`
+	ScratchDir string      `json:"scratch_dir,omitempty"`
+	BindMounts []BindMount `json:"bind_mounts,omitempty"`
+	Artifacts  string      `json:"artifacts,omitempty"`
+	RunAs      *Credential `json:"run_as,omitempty"`
+	Env        []string    `json:"env,omitempty"`
+	ClearEnv   bool        `json:"clear_env,omitempty"`
+	Dir        string      `json:"dir,omitempty"`
+}
+
+// initStatus is written by the init process once the command has started (Pid
+// or Error set) and once more when it has exited.
+type initStatus struct {
+	Pid      int    `json:"pid,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Exited   bool   `json:"exited,omitempty"`
+	ExitCode int    `json:"exit_code,omitempty"`
+	Signal   int    `json:"signal,omitempty"`
+}
+
+// Init runs the init process of a job when the current process was started by
+// a Worker, and returns immediately otherwise. Programs that use a Worker must
+// call Init at the very beginning of main (or TestMain).
+func Init() {
+	if len(os.Args) == 0 || os.Args[0] != initProcessName {
+		return
+	}
+	os.Exit(runInit())
+}
+
+func runInit() int {
+	// The parent death signal of the command is tied to the thread that
+	// started it, so keep that thread alive for the lifetime of the command.
+	runtime.LockOSThread()
+
+	// Prevent the command from inheriting the pipes
+	syscall.CloseOnExec(initConfigFD)
+	syscall.CloseOnExec(initStatusFD)
+	syscall.CloseOnExec(initExitFD)
+	configFile := os.NewFile(initConfigFD, "config")
+	statusFile := os.NewFile(initStatusFD, "status")
+	exitFile := os.NewFile(initExitFD, "exit")
+	status := json.NewEncoder(statusFile)
+
+	var config initConfig
+	if err := json.NewDecoder(configFile).Decode(&config); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: error reading config: %v\n", initProcessName, err)
+		return 1
+	}
+	configFile.Close()
+
+	if err := setup(config); err != nil {
+		_ = status.Encode(initStatus{Error: err.Error()})
+		return 1
+	}
+
+	env := config.Env
+	if !config.ClearEnv {
+		env = append(os.Environ(), env...)
+	}
+	if config.Artifacts != "" {
+		artifacts := config.Artifacts
+		if config.RootFS != "" {
+			artifacts = artifactsMountPoint
+		}
+		env = append(env, artifactsEnv+"="+artifacts)
+	}
+	// Look up the command using the PATH of the job environment
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "PATH=") {
+			os.Setenv("PATH", strings.TrimPrefix(kv, "PATH="))
+		}
+	}
+
+	cmd := exec.Command(config.Cmd, config.Args...)
+	// A nil environment would inherit the environment of the init process
+	cmd.Env = append([]string{}, env...)
+	cmd.Dir = config.Dir
+	cmd.Stdin = os.Stdin
+	cmd.SysProcAttr = commandSysProcAttr(config.RunAs)
+
+	// The streams of the command are piped through the init process, which
+	// tags their lines in the log file it was given as its own stdout
+	stdout, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		_ = status.Encode(initStatus{Error: err.Error()})
+		return 1
+	}
+	stderr, stderrWriter, err := os.Pipe()
+	if err != nil {
+		_ = status.Encode(initStatus{Error: err.Error()})
+		return 1
+	}
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = stderrWriter
+
+	// Signals are sent to the process group of the job, which the command
+	// inherits, so the init process only has to survive them to report the
+	// exit status of the command.
+	signal.Notify(make(chan os.Signal, 1))
+
+	err = cmd.Start()
+	stdoutWriter.Close()
+	stderrWriter.Close()
+	if err != nil {
+		_ = status.Encode(initStatus{Error: err.Error()})
+		return 1
+	}
+	output := copyOutput(stdout, stderr)
+	if err := status.Encode(initStatus{Pid: cmd.Process.Pid}); err != nil {
+		_ = cmd.Process.Kill()
+	}
+
+	_ = cmd.Wait()
+	select {
+	case <-output:
+	case <-time.After(outputDrainTimeout):
+	}
+
+	exit := initStatus{Exited: true}
+	waitStatus, _ := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if waitStatus.Signaled() {
+		exit.Signal = int(waitStatus.Signal())
+		exit.ExitCode = -1
+	} else {
+		exit.ExitCode = waitStatus.ExitStatus()
+	}
+	_ = json.NewEncoder(exitFile).Encode(exit)
+	_ = status.Encode(exit)
+
+	if exit.Signal != 0 {
+		return 128 + exit.Signal
+	}
+	return exit.ExitCode
+}
+
+// copyOutput writes the lines of the streams of the command to the log file
+// and returns a channel closed once both streams are closed. The lines of each
+// stream are written in order, but the streams are read concurrently, so lines
+// of different streams written at nearly the same time may be reordered.
+func copyOutput(stdout, stderr *os.File) <-chan struct{} {
+	log := &logWriter{out: os.Stdout}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	for stream, file := range map[LogStream]*os.File{LogStreamStdout: stdout, LogStreamStderr: stderr} {
+		go func(stream LogStream, file *os.File) {
+			defer wg.Done()
+			if err := log.copy(stream, file); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: error copying output: %v\n", initProcessName, err)
+			}
+		}(stream, file)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done
+}
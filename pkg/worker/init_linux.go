@@ -0,0 +1,75 @@
+package worker
+
+import (
+	"fmt"
+	"path/filepath"
+	"syscall"
+)
+
+func initExecutable() (string, error) {
+	return "/proc/self/exe", nil
+}
+
+// initSysProcAttr creates the namespaces the init process of a job runs in and
+// puts it in a new process group shared with the command.
+func initSysProcAttr(command Command) (*syscall.SysProcAttr, error) {
+	var flags uintptr
+	if command.Isolation != nil {
+		flags |= command.Isolation.cloneflags()
+	}
+	if command.RootFS != "" {
+		flags |= syscall.CLONE_NEWNS
+	}
+	return &syscall.SysProcAttr{
+		Cloneflags: flags,
+		Setpgid:    true,
+	}, nil
+}
+
+// commandSysProcAttr runs the command as the credential and ensures it does not
+// outlive its init process.
+func commandSysProcAttr(credential *Credential) *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Credential: credential.sys(),
+		Pdeathsig:  syscall.SIGKILL,
+	}
+}
+
+// setup is run by the init process to prepare its namespaces before the
+// command is started.
+func setup(config initConfig) error {
+	if config.Isolation == nil && config.RootFS == "" {
+		return nil
+	}
+
+	// Stop mounts from propagating back to the host mount namespace
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("error making mounts private: %w", err)
+	}
+
+	root := "/"
+	if config.RootFS != "" {
+		root = filepath.Join(config.ScratchDir, "merged")
+		if err := mountRootFS(config.RootFS, config.ScratchDir, root, config.BindMounts, config.Artifacts); err != nil {
+			return err
+		}
+	}
+
+	if err := mountProc(root); err != nil {
+		return err
+	}
+
+	if config.RootFS != "" {
+		if err := pivotRoot(root); err != nil {
+			return err
+		}
+	}
+
+	if config.Isolation != nil {
+		if err := setupIsolation(config.Isolation, config.Hostname); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
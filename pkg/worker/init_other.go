@@ -0,0 +1,38 @@
+//go:build !linux
+
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+var errNamespacesUnsupported = errors.New("job isolation and root filesystems are only supported on linux")
+
+func initExecutable() (string, error) {
+	return os.Executable()
+}
+
+func initSysProcAttr(command Command) (*syscall.SysProcAttr, error) {
+	if command.Isolation != nil || command.RootFS != "" {
+		return nil, fmt.Errorf("%w: %v", ErrorInvalidCommand, errNamespacesUnsupported)
+	}
+	return &syscall.SysProcAttr{
+		Setpgid: true,
+	}, nil
+}
+
+func commandSysProcAttr(credential *Credential) *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Credential: credential.sys(),
+	}
+}
+
+func setup(config initConfig) error {
+	if config.Isolation != nil || config.RootFS != "" {
+		return errNamespacesUnsupported
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+package worker
+
+// Isolation runs a job in new PID, mount, UTS, IPC and network namespaces with
+// its own /proc, so the job can only see its own process tree.
+type Isolation struct {
+	// HostNetwork keeps the job in the host network namespace. Otherwise the
+	// job only has a loopback interface.
+	HostNetwork bool `json:"host_network"`
+}
@@ -0,0 +1,56 @@
+package worker
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+func (i *Isolation) cloneflags() uintptr {
+	flags := uintptr(syscall.CLONE_NEWPID | syscall.CLONE_NEWNS | syscall.CLONE_NEWUTS | syscall.CLONE_NEWIPC)
+	if !i.HostNetwork {
+		flags |= syscall.CLONE_NEWNET
+	}
+	return flags
+}
+
+func setupIsolation(isolation *Isolation, hostname string) error {
+	if err := syscall.Sethostname([]byte(hostname)); err != nil {
+		return fmt.Errorf("error setting hostname: %w", err)
+	}
+	if !isolation.HostNetwork {
+		if err := setLinkUp("lo"); err != nil {
+			return fmt.Errorf("error bringing up loopback interface: %w", err)
+		}
+	}
+	return nil
+}
+
+type ifreqFlags struct {
+	name  [syscall.IFNAMSIZ]byte
+	flags uint16
+	_     [22]byte
+}
+
+func setLinkUp(name string) error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	var req ifreqFlags
+	copy(req.name[:], name)
+	if err = ioctl(fd, syscall.SIOCGIFFLAGS, unsafe.Pointer(&req)); err != nil {
+		return err
+	}
+	req.flags |= syscall.IFF_UP
+	return ioctl(fd, syscall.SIOCSIFFLAGS, unsafe.Pointer(&req))
+}
+
+func ioctl(fd int, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
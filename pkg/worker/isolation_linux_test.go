@@ -0,0 +1,60 @@
+package worker
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJob_isolation(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("creating namespaces requires root")
+	}
+
+	script := "cat /proc/sys/kernel/hostname; set -- /proc/[0-9]*; echo $#; tail -n +3 /proc/net/dev | cut -d: -f1"
+
+	tests := []struct {
+		name       string
+		isolation  Isolation
+		wantLoOnly bool
+	}{
+		{
+			name:       "loopback network",
+			isolation:  Isolation{},
+			wantLoOnly: true,
+		},
+		{
+			name:      "host network",
+			isolation: Isolation{HostNetwork: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolation := tt.isolation
+			job, err := NewJob(Command{Cmd: "sh", Args: []string{"-c", script}, Isolation: &isolation}, t.TempDir())
+			require.NoError(t, err)
+			require.NoError(t, job.Start())
+
+			logs := readLogs(t, job)
+			require.Equal(t, 0, job.Status.ExitCode, logs)
+			require.GreaterOrEqual(t, len(logs), 3)
+
+			require.Equal(t, job.ID, logs[0])
+			// Only the init process and sh are visible
+			require.Equal(t, "2", logs[1])
+
+			interfaces := logs[2:]
+			for i := range interfaces {
+				interfaces[i] = strings.TrimSpace(interfaces[i])
+			}
+			if tt.wantLoOnly {
+				require.Equal(t, []string{"lo"}, interfaces)
+			} else {
+				require.Contains(t, interfaces, "lo")
+			}
+		})
+	}
+}
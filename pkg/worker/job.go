@@ -1,135 +1,789 @@
 package worker
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
-const logFilePattern = "jobrunner_log_"
+const (
+	logFilePattern     = "jobrunner_log_"
+	DefaultGracePeriod = 10 * time.Second
+)
+
+// The files of a job in its directory, which is named after its ID.
+const (
+	logFileName      = "output.log"
+	metadataFileName = "job.json"
+	exitFileName     = "exit"
+	scratchDirName   = "rootfs"
+	// artifactsDirName is the directory of files kept with the job, which is
+	// deleted with it. It is owned by the user the job runs as and its path is
+	// given to the command in the artifactsEnv environment variable.
+	artifactsDirName = "artifacts"
+)
+
+const (
+	artifactsEnv = "JOBRUNNER_ARTIFACTS"
+	// artifactsMountPoint is where the artifacts directory is mounted in the
+	// root filesystem of jobs that have one.
+	artifactsMountPoint = "/artifacts"
+)
 
 type JobState int
 
 const (
 	JobStateUnspecified JobState = iota
-	JobStatePending
+	// JobStateQueued is the state of a job that has been created but not
+	// started.
+	JobStateQueued
+	// JobStateStarting is the state of a job while its environment is set up
+	// and its command is started.
+	JobStateStarting
 	JobStateRunning
-	JobStateCompleted
+	// JobStateSucceeded is the state of a job whose command exited with 0.
+	JobStateSucceeded
+	// JobStateFailed is the state of a job whose command exited with a
+	// non-zero code or was terminated by a signal it was not sent by a stop.
+	JobStateFailed
+	JobStateStopped
+	// JobStateTimedOut is the state of a job stopped because it exceeded its
+	// timeout.
+	JobStateTimedOut
+	// JobStateFailedToStart is the state of a job whose environment could not
+	// be set up or whose command could not be started.
+	JobStateFailedToStart
+	// JobStateLost is the state of a job whose worker exited while it was
+	// running and whose exit status could not be recovered.
+	JobStateLost
 )
 
+var stateNames = map[JobState]string{
+	JobStateUnspecified:   "unspecified",
+	JobStateQueued:        "queued",
+	JobStateStarting:      "starting",
+	JobStateRunning:       "running",
+	JobStateSucceeded:     "succeeded",
+	JobStateFailed:        "failed",
+	JobStateStopped:       "stopped",
+	JobStateTimedOut:      "timed_out",
+	JobStateFailedToStart: "failed_to_start",
+	JobStateLost:          "lost",
+}
+
+func (s JobState) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("JobState(%d)", int(s))
+}
+
+func parseJobState(name string) (JobState, error) {
+	for state, stateName := range stateNames {
+		if stateName == name {
+			return state, nil
+		}
+	}
+	return JobStateUnspecified, fmt.Errorf("unknown job state %q", name)
+}
+
+// Terminal reports whether the state is final, i.e. the job has completed.
+func (s JobState) Terminal() bool {
+	switch s {
+	case JobStateSucceeded, JobStateFailed, JobStateStopped, JobStateTimedOut, JobStateFailedToStart, JobStateLost:
+		return true
+	}
+	return false
+}
+
 type CancelFunc func()
 
 type Command struct {
-	Cmd  string
-	Args []string
+	Cmd       string
+	Args      []string
+	Limits    *ResourceLimits
+	Isolation *Isolation
+	// RootFS is a directory the job uses as its root filesystem. Changes made
+	// by the job are written to a scratch overlay removed when it completes.
+	RootFS     string
+	BindMounts []BindMount
+	// RunAs is the user the job runs as, which defaults to the worker's
+	// default credential or else the user running the worker.
+	RunAs *Credential
+	// Env holds environment variables in the form "key=value" which are added
+	// to the environment of the worker, or replace it if ClearEnv is set.
+	Env      []string
+	ClearEnv bool
+	Dir      string
+	Stdin    []byte
+	// Timeout is the maximum runtime of the job, after which it is stopped
+	// with the default StopOptions. Zero means no timeout.
+	Timeout time.Duration
 }
 
 type JobStatus struct {
-	State     JobState
-	ExitCode  int
+	State    JobState
+	ExitCode int
+	// ExitError describes why the job failed to start or how its command
+	// exited when it was not successful.
 	ExitError error
+	// Signal is the signal that terminated the job, if any.
+	Signal    syscall.Signal
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// StopOptions control how a job is stopped. Signal (SIGTERM by default) is sent
+// first and the job is killed if it is still running after GracePeriod
+// (DefaultGracePeriod by default).
+type StopOptions struct {
+	Signal      syscall.Signal
+	GracePeriod time.Duration
+}
+
+type JobEventType string
+
+const (
+	// JobEventStarting is sent once the init process of a job is spawned,
+	// before the command is started, so that the job can be reattached if the
+	// worker exits while it starts.
+	JobEventStarting JobEventType = "starting"
+	// JobEventStarted is sent once a job is running.
+	JobEventStarted JobEventType = "started"
+	// JobEventStopping is sent when a job is sent the signal to stop.
+	JobEventStopping JobEventType = "stopping"
+	// JobEventCompleted is sent once a job is in a terminal state, including
+	// when it failed to start.
+	JobEventCompleted JobEventType = "completed"
+)
+
+// JobEvent is a change in the lifecycle of a job.
+type JobEvent struct {
+	Type JobEventType
+	Job  JobSummary
+	// Signal is the signal sent to stop the job.
+	Signal syscall.Signal
+	// StopState is the state a stopping job completes in unless it exits by
+	// itself first.
+	StopState JobState
+	// record is the record of the job when the event was emitted.
+	record JobRecord
+}
+
+// Metadata describes a job without affecting how it runs.
+type Metadata struct {
+	// Owner is the subject that started the job.
+	Owner string
+	// Domain is the tenant domain the job was started in.
+	Domain string
+	// Labels identify the job and can be selected on.
+	Labels map[string]string
+	// Annotations record information about the job but cannot be selected on.
+	Annotations map[string]string
 }
 
 type Job struct {
 	sync.Mutex
-	ID      string
-	Status  JobStatus
-	cmd     *exec.Cmd
+	ID         string
+	Metadata   Metadata
+	CreateTime time.Time
+	Status     JobStatus
+	command    Command
+	opts       options
+	cmd        *exec.Cmd
+	// dir is the directory holding the files of the job.
+	dir     string
 	logFile *os.File
-	done    bool
+	// exitFile is the path of the file the init process writes the exit
+	// status of the command to.
+	exitFile string
+	// pid and pidStartTime identify the init process, whose PID is also the
+	// ID of the process group of the job.
+	pid          int
+	pidStartTime uint64
+	cgroup       *cgroup
+	scratch      string
+	status       *os.File
+	// statusDecoder reads the messages of the init process from status. It is
+	// shared as the decoder may buffer more than one message.
+	statusDecoder *json.Decoder
+	timer         *time.Timer
+	// stopState is the state of the job once it completes if it was stopped
+	// before it exited by itself.
+	stopState JobState
+	// events are the events emitted while the job was locked, which are sent
+	// to the event handler in order once it is unlocked. eventsMu serializes
+	// sending them.
+	events   []JobEvent
+	eventsMu sync.Mutex
+	// started is closed once Start returns, so that the job is running or
+	// failed to start. It is nil for reattached jobs, which already started.
+	started chan struct{}
+	done    chan struct{}
 }
 
-func NewJob(command Command, logDir string) (*Job, error) {
+func NewJob(command Command, logDir string, opts ...Option) (*Job, error) {
+	if command.Limits != nil {
+		if err := command.Limits.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateRootFS(command); err != nil {
+		return nil, err
+	}
+	if err := validateEnvironment(command); err != nil {
+		return nil, err
+	}
+	if command.Timeout < 0 {
+		return nil, fmt.Errorf("%w: timeout must not be negative", ErrorInvalidCommand)
+	}
+
+	executable, err := initExecutable()
+	if err != nil {
+		return nil, err
+	}
+
+	sysProcAttr, err := initSysProcAttr(command)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each job has its own directory, as its output may be sensitive. It can
+	// be searched but not listed by others, so that jobs running as other users
+	// reach their artifacts directory.
 	jobID := uuid.New().String()
-	path := filepath.Join(logDir, fmt.Sprintf("%s.log", jobID))
+	dir := filepath.Join(logDir, jobID)
+	if err := os.Mkdir(dir, 0711); err != nil {
+		return nil, err
+	}
+	if err := os.Mkdir(filepath.Join(dir, artifactsDirName), 0700); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
 
-	logFile, err := os.Create(path)
+	logFile, err := os.OpenFile(filepath.Join(dir, logFileName), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
 	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	if _, err := logFile.WriteString(logHeader + "\n"); err != nil {
+		logFile.Close()
+		os.RemoveAll(dir)
 		return nil, err
 	}
 
-	cmd := exec.Command(command.Cmd, command.Args...)
+	// Jobs are run by an init process (this binary re-executed) which sets up
+	// the job environment and then starts the command itself.
+	cmd := exec.Command(executable)
+	cmd.Args = []string{initProcessName}
 	cmd.Stdout = logFile
 	cmd.Stderr = logFile
+	cmd.SysProcAttr = sysProcAttr
+	if len(command.Stdin) > 0 {
+		cmd.Stdin = bytes.NewReader(command.Stdin)
+	}
 
 	job := &Job{
-		ID: jobID,
+		ID:         jobID,
+		CreateTime: time.Now(),
 		Status: JobStatus{
-			State: JobStatePending,
+			State: JobStateQueued,
 		},
-		cmd:     cmd,
-		logFile: logFile,
+		command:  command,
+		opts:     newOptions(opts),
+		cmd:      cmd,
+		dir:      dir,
+		logFile:  logFile,
+		exitFile: filepath.Join(dir, exitFileName),
+		started:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	if command.RootFS != "" {
+		job.scratch = filepath.Join(dir, scratchDirName)
 	}
 
 	return job, nil
 }
 
+// jobMetadata is the description of a job written to its directory.
+type jobMetadata struct {
+	ID          string            `json:"id"`
+	Owner       string            `json:"owner,omitempty"`
+	Domain      string            `json:"domain,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Cmd         string            `json:"cmd"`
+	Args        []string          `json:"args,omitempty"`
+	CreateTime  time.Time         `json:"create_time"`
+}
+
+// writeMetadata writes the description of the job to its directory, so that
+// its output can be identified without the job store.
+func (j *Job) writeMetadata() error {
+	data, err := json.MarshalIndent(jobMetadata{
+		ID:          j.ID,
+		Owner:       j.Metadata.Owner,
+		Domain:      j.Metadata.Domain,
+		Labels:      j.Metadata.Labels,
+		Annotations: j.Metadata.Annotations,
+		Cmd:         j.command.Cmd,
+		Args:        j.command.Args,
+		CreateTime:  j.CreateTime,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(j.dir, metadataFileName), data, 0600)
+}
+
 func (j *Job) Start() error {
+	defer close(j.started)
+	j.setState(JobStateStarting)
+
+	if err := j.start(); err != nil {
+		j.Lock()
+		j.Status.State = JobStateFailedToStart
+		j.Status.ExitError = err
+		j.Status.EndTime = time.Now()
+		j.emit(JobEvent{Type: JobEventCompleted})
+		j.Unlock()
+		j.sendEvents()
+		j.cleanup()
+		return err
+	}
+
+	j.Lock()
 	j.Status.State = JobStateRunning
+	j.Status.StartTime = time.Now()
+	j.emit(JobEvent{Type: JobEventStarted})
+	j.Unlock()
+	j.sendEvents()
+
+	if j.command.Timeout > 0 {
+		j.startTimer(j.command.Timeout)
+	}
+
+	go j.wait()
+
+	return nil
+}
+
+// startTimer stops the job as timed out after the duration.
+func (j *Job) startTimer(d time.Duration) {
+	j.timer = time.AfterFunc(d, func() {
+		if err := j.stop(StopOptions{}, JobStateTimedOut); err != nil {
+			zap.L().Error("error stopping timed out job", zap.String("job", j.ID), zap.Error(err))
+		}
+	})
+}
 
-	if err := j.cmd.Start(); err != nil {
-		j.Status.State = JobStateCompleted
+func (j *Job) start() error {
+	// Jobs are put in a cgroup whenever possible, as unlike the process group it
+	// holds every descendant of the command. It is only required for limits.
+	var limits ResourceLimits
+	if j.command.Limits != nil {
+		limits = *j.command.Limits
+	}
+	cg, err := newCgroup(j.opts.cgroupRoot, j.ID, limits)
+	switch {
+	case err == nil:
+		j.cgroup = cg
+	case j.command.Limits != nil:
 		return err
+	default:
+		zap.L().Debug("job cgroup unavailable", zap.String("job", j.ID), zap.Error(err))
 	}
 
-	go func() {
-		err := j.cmd.Wait()
-		j.Lock()
-		defer j.Unlock()
+	if j.scratch != "" {
+		for _, dir := range []string{"upper", "work", "merged"} {
+			if err := os.MkdirAll(filepath.Join(j.scratch, dir), 0700); err != nil {
+				return err
+			}
+		}
+	}
 
-		if err != nil {
+	runAs := j.command.RunAs
+	if runAs == nil {
+		runAs = j.opts.defaultCredential
+	}
+	artifacts := filepath.Join(j.dir, artifactsDirName)
+	if runAs != nil {
+		if err := os.Chown(artifacts, int(runAs.UID), int(runAs.GID)); err != nil {
+			return err
+		}
+	}
+
+	configReader, configWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer configWriter.Close()
+
+	statusReader, statusWriter, err := os.Pipe()
+	if err != nil {
+		configReader.Close()
+		return err
+	}
+
+	exitFile, err := os.OpenFile(j.exitFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		configReader.Close()
+		statusReader.Close()
+		statusWriter.Close()
+		return err
+	}
+
+	j.cmd.ExtraFiles = []*os.File{configReader, statusWriter, exitFile}
+	err = j.cmd.Start()
+	configReader.Close()
+	statusWriter.Close()
+	exitFile.Close()
+	if err != nil {
+		statusReader.Close()
+		return err
+	}
+	j.status = statusReader
+	j.statusDecoder = json.NewDecoder(statusReader)
+	// The start time is unavailable on some platforms, where jobs cannot be
+	// reattached after the worker exits
+	pidStartTime, _ := processStartTime(j.cmd.Process.Pid)
+	j.Lock()
+	j.pid = j.cmd.Process.Pid
+	j.pidStartTime = pidStartTime
+	j.emit(JobEvent{Type: JobEventStarting})
+	j.Unlock()
+	j.sendEvents()
+
+	// The init process blocks until it receives its config, so it can be moved
+	// into the job cgroup before the command is started.
+	if j.cgroup != nil {
+		if err = j.cgroup.addProcess(j.cmd.Process.Pid); err != nil {
+			j.abort()
+			return err
+		}
+	}
+
+	config := initConfig{
+		Cmd:        j.command.Cmd,
+		Args:       j.command.Args,
+		Hostname:   j.ID,
+		Isolation:  j.command.Isolation,
+		RootFS:     j.command.RootFS,
+		ScratchDir: j.scratch,
+		BindMounts: j.command.BindMounts,
+		Artifacts:  artifacts,
+		RunAs:      runAs,
+		Env:        j.command.Env,
+		ClearEnv:   j.command.ClearEnv,
+		Dir:        j.command.Dir,
+	}
+	if err = json.NewEncoder(configWriter).Encode(config); err != nil {
+		j.abort()
+		return err
+	}
+
+	var started initStatus
+	if err = j.statusDecoder.Decode(&started); err != nil {
+		j.abort()
+		return fmt.Errorf("error starting job init process: %w", err)
+	}
+	if started.Error != "" {
+		j.abort()
+		return errors.New(started.Error)
+	}
+
+	return nil
+}
+
+// abort kills and reaps the init process of a job that failed to start.
+func (j *Job) abort() {
+	_ = j.signal(syscall.SIGKILL)
+	_ = j.cmd.Wait()
+	j.status.Close()
+}
+
+func (j *Job) wait() {
+	var exit initStatus
+	decodeErr := j.statusDecoder.Decode(&exit)
+	// Kill descendants left behind by the command. The process group cannot be
+	// reused until the init process is reaped.
+	if err := j.signal(syscall.SIGKILL); err != nil {
+		zap.L().Error("error killing job process group", zap.String("job", j.ID), zap.Error(err))
+	}
+	err := j.cmd.Wait()
+	j.status.Close()
+
+	j.complete(func() {
+		if decodeErr == nil && exit.Exited {
+			j.setExitStatus(exit)
+		} else if err != nil {
+			// The init process was terminated before it could report the
+			// exit status of the command
 			if exitErr, ok := err.(*exec.ExitError); ok {
 				j.Status.ExitCode = exitErr.ExitCode()
+				if waitStatus, ok := exitErr.Sys().(syscall.WaitStatus); ok && waitStatus.Signaled() {
+					j.Status.Signal = waitStatus.Signal()
+				}
 			}
 			j.Status.ExitError = err
 		}
+	})
+}
+
+// complete moves the job to its terminal state once its init process has
+// exited, after setExitStatus has set the exit status of the job.
+func (j *Job) complete(setExitStatus func()) {
+	if j.timer != nil {
+		j.timer.Stop()
+	}
+
+	j.Lock()
+	setExitStatus()
+	switch {
+	case j.stopState != JobStateUnspecified:
+		j.Status.State = j.stopState
+	case errors.Is(j.Status.ExitError, errJobLost):
+		j.Status.State = JobStateLost
+	case j.Status.ExitError == nil:
+		j.Status.State = JobStateSucceeded
+	default:
+		j.Status.State = JobStateFailed
+	}
+	j.Status.EndTime = time.Now()
+	j.emit(JobEvent{Type: JobEventCompleted})
+	j.Unlock()
+
+	// The completed event is sent before waiters are released
+	j.sendEvents()
+	j.cleanup()
+}
+
+func (j *Job) setExitStatus(exit initStatus) {
+	j.Status.ExitCode = exit.ExitCode
+	j.Status.ExitError = exitError(exit)
+	j.Status.Signal = syscall.Signal(exit.Signal)
+}
+
+func (j *Job) setState(state JobState) {
+	j.Lock()
+	defer j.Unlock()
+	j.Status.State = state
+}
+
+// emit queues the event for the event handler, if any. The job must be locked,
+// and sendEvents must be called once it is unlocked.
+func (j *Job) emit(event JobEvent) {
+	if j.opts.eventHandler == nil {
+		return
+	}
+	event.record = j.recordLocked()
+	event.Job = event.record.JobSummary
+	j.events = append(j.events, event)
+}
+
+// sendEvents sends the queued events to the event handler in the order they
+// were emitted. The job must not be locked, so that the handler does not
+// block other calls on the job.
+func (j *Job) sendEvents() {
+	j.eventsMu.Lock()
+	defer j.eventsMu.Unlock()
+	for {
+		j.Lock()
+		events := j.events
+		j.events = nil
+		j.Unlock()
+		if len(events) == 0 {
+			return
+		}
+		for _, event := range events {
+			j.opts.eventHandler(event)
+		}
+	}
+}
+
+// Query returns the current status of the job.
+func (j *Job) Query() JobStatus {
+	j.Lock()
+	defer j.Unlock()
+	return j.Status
+}
+
+func (j *Job) cleanup() {
+	if err := j.logFile.Close(); err != nil {
+		zap.L().Error("error closing log file", zap.Error(err))
+	}
 
-		j.Status.State = JobStateCompleted
+	if err := os.Remove(j.exitFile); err != nil && !os.IsNotExist(err) {
+		zap.L().Error("error removing job exit file", zap.String("file", j.exitFile), zap.Error(err))
+	}
 
-		if err := j.logFile.Close(); err != nil {
-			zap.L().Error("error closing log file", zap.Error(err))
+	if j.cgroup != nil {
+		if err := j.cgroup.remove(); err != nil {
+			zap.L().Error("error removing job cgroup", zap.String("cgroup", j.cgroup.path), zap.Error(err))
 		}
+	}
 
-		j.done = true
-	}()
+	if j.scratch != "" {
+		if err := os.RemoveAll(j.scratch); err != nil {
+			zap.L().Error("error removing job scratch directory", zap.String("dir", j.scratch), zap.Error(err))
+		}
+	}
 
+	close(j.done)
+}
+
+// Stop sends the stop signal to the job and kills it if it has not exited
+// after the grace period. Stop returns once the job has completed.
+func (j *Job) Stop(opts StopOptions) error {
+	return j.stop(opts, JobStateStopped)
+}
+
+// stop stops the job, which completes in state unless it already exited.
+func (j *Job) stop(opts StopOptions, state JobState) error {
+	if opts.Signal == 0 {
+		opts.Signal = syscall.SIGTERM
+	}
+	if opts.GracePeriod == 0 {
+		opts.GracePeriod = DefaultGracePeriod
+	}
+
+	j.Lock()
+	switch {
+	case j.Status.State.Terminal():
+		j.Unlock()
+		return nil
+	case j.Status.State != JobStateRunning:
+		j.Unlock()
+		return ErrorJobNotStarted
+	}
+	if j.stopState == JobStateUnspecified {
+		j.stopState = state
+	}
+	j.emit(JobEvent{Type: JobEventStopping, Signal: opts.Signal, StopState: j.stopState})
+	j.Unlock()
+	j.sendEvents()
+
+	if err := j.signal(opts.Signal); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(opts.GracePeriod)
+	defer timer.Stop()
+
+	select {
+	case <-j.done:
+		return nil
+	case <-timer.C:
+	}
+
+	if err := j.signal(syscall.SIGKILL); err != nil {
+		return err
+	}
+	j.Wait()
 	return nil
 }
 
-func (j *Job) FollowLogs() (<-chan string, CancelFunc, error) {
+// signal sends sig to the process group of the job, which holds the init
+// process, the command and any descendants that have not left the group.
+// SIGKILL is also sent to every process in the cgroup of the job, if it has
+// one, which holds the descendants that left the group too.
+func (j *Job) signal(sig syscall.Signal) error {
+	j.Lock()
+	pid := j.pid
+	j.Unlock()
+	// Never signal the process group of the worker
+	if pid > 0 {
+		if err := syscall.Kill(-pid, sig); err != nil && err != syscall.ESRCH {
+			return err
+		}
+	}
+	if sig != syscall.SIGKILL || j.cgroup == nil {
+		return nil
+	}
+	// The cgroup is removed once the job completes
+	if err := j.cgroup.kill(); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// FollowLogs streams the lines of the stream of the job, or both streams if it
+// is LogStreamAll, until it completes.
+func (j *Job) FollowLogs(stream LogStream) (<-chan LogLine, CancelFunc, error) {
 	logs, err := NewLogFile(j.logFile.Name())
 	if err != nil {
 		return nil, nil, err
 	}
 
+	// Following stops once the job completes and the rest of its logs are
+	// read, or once it is canceled
 	stopCh := make(chan bool)
+	logCh, cancelFollow, err := logs.Follow(stopCh, stream)
+	if err != nil {
+		logs.Close()
+		return nil, nil, err
+	}
 
+	canceled := make(chan struct{})
+	var cancelOnce sync.Once
+	cancel := func() {
+		cancelOnce.Do(func() {
+			close(canceled)
+			cancelFollow()
+		})
+	}
 	go func() {
-		j.Wait()
-		stopCh <- true
+		select {
+		case <-j.done:
+			close(stopCh)
+		case <-canceled:
+		}
 	}()
 
-	cancelFunc := func() {
-		stopCh <- true
-	}
+	return logCh, cancel, nil
+}
 
-	logCh, err := logs.Follow(stopCh)
-	if err != nil {
-		return nil, nil, err
-	}
+func (j *Job) Wait() {
+	<-j.done
+}
 
-	return logCh, cancelFunc, nil
+// waitStarted blocks until the job is no longer starting.
+func (j *Job) waitStarted() {
+	if j.started != nil {
+		<-j.started
+	}
 }
 
-func (j *Job) Wait() {
-	for {
-		if j.done {
-			return
+func validateEnvironment(command Command) error {
+	for _, kv := range command.Env {
+		if key, _, ok := strings.Cut(kv, "="); !ok || key == "" {
+			return fmt.Errorf("%w: environment variable %q must be in the form key=value", ErrorInvalidCommand, kv)
 		}
 	}
+	if command.Dir != "" && !filepath.IsAbs(command.Dir) {
+		return fmt.Errorf("%w: working directory %q must be absolute", ErrorInvalidCommand, command.Dir)
+	}
+	return nil
+}
+
+func exitError(exit initStatus) error {
+	if exit.Signal != 0 {
+		return fmt.Errorf("signal: %v", syscall.Signal(exit.Signal))
+	}
+	if exit.ExitCode != 0 {
+		return fmt.Errorf("exit status %d", exit.ExitCode)
+	}
+	return nil
 }
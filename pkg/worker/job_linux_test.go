@@ -0,0 +1,102 @@
+package worker
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJob_stopKillsDescendants(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		wantPids int
+		cgroup   bool
+	}{
+		{
+			// The first sleep is orphaned by its subshell and reparented, the
+			// second is a direct child of sh. Both ignore SIGTERM.
+			name:     "process group",
+			script:   "trap '' TERM; (sleep 60 & echo $!); sleep 60 & echo $!; echo ready; wait",
+			wantPids: 2,
+		},
+		{
+			// The sleep leaves the process group of the job, so only its
+			// cgroup still holds it
+			name:     "new session",
+			script:   "trap '' TERM; setsid sleep 60 & echo $!; echo ready; wait",
+			wantPids: 1,
+			cgroup:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []Option
+			if tt.cgroup {
+				opts = append(opts, WithCgroupRoot(cgroup2Root(t)))
+			}
+
+			job, err := NewJob(Command{Cmd: "sh", Args: []string{"-c", tt.script}}, t.TempDir(), opts...)
+			require.NoError(t, err)
+			require.NoError(t, job.Start())
+			if tt.cgroup && job.cgroup == nil {
+				require.NoError(t, job.Stop(StopOptions{GracePeriod: 100 * time.Millisecond}))
+				t.Skip("job cgroup unavailable")
+			}
+
+			pids := readPids(t, job)
+			require.Len(t, pids, tt.wantPids)
+
+			require.NoError(t, job.Stop(StopOptions{GracePeriod: 100 * time.Millisecond}))
+			requireProcessesExited(t, pids)
+		})
+	}
+}
+
+func TestJob_exitKillsDescendants(t *testing.T) {
+	script := "sleep 60 & echo $!; echo ready"
+
+	job, err := NewJob(Command{Cmd: "sh", Args: []string{"-c", script}}, t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, job.Start())
+
+	pids := readPids(t, job)
+	require.Len(t, pids, 1)
+
+	job.Wait()
+	require.Equal(t, 0, job.Status.ExitCode)
+	requireProcessesExited(t, pids)
+}
+
+// readPids reads the pids logged by a job until it logs "ready".
+func readPids(t *testing.T, job *Job) []int {
+	logCh, cancel, err := job.FollowLogs(LogStreamAll)
+	require.NoError(t, err)
+	defer cancel()
+
+	var pids []int
+	for log := range logCh {
+		if log.Text == "ready" {
+			return pids
+		}
+		pid, err := strconv.Atoi(log.Text)
+		require.NoError(t, err)
+		pids = append(pids, pid)
+	}
+	t.Fatal("job completed without logging ready")
+	return nil
+}
+
+func requireProcessesExited(t *testing.T, pids []int) {
+	require.Eventually(t, func() bool {
+		for _, pid := range pids {
+			if _, err := processStartTime(pid); err == nil {
+				return false
+			}
+		}
+		return true
+	}, 2*time.Second, 10*time.Millisecond)
+}
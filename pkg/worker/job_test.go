@@ -1,7 +1,9 @@
 package worker
 
 import (
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -13,18 +15,155 @@ func TestJob(t *testing.T) {
 	cmd := echoLoop(numLogs, 0.1, wantLog)
 	job, err := NewJob(cmd, t.TempDir())
 	require.NoError(t, err)
-	require.Equal(t, JobStatePending, job.Status.State)
+	require.Equal(t, JobStateQueued, job.Status.State)
 
 	err = job.Start()
 	require.NoError(t, err)
-	require.Equal(t, JobStateRunning, job.Status.State)
+	require.Equal(t, JobStateRunning, job.Query().State)
 
-	logCh, _, err := job.FollowLogs()
+	logCh, _, err := job.FollowLogs(LogStreamAll)
 	require.NoError(t, err)
 	for i := 0; i < numLogs; i++ {
-		require.Equal(t, wantLog, <-logCh)
+		require.Equal(t, wantLog, (<-logCh).Text)
 	}
 
 	job.Wait()
-	require.Equal(t, JobStateCompleted, job.Status.State)
+	require.Equal(t, JobStateSucceeded, job.Status.State)
+	require.False(t, job.Status.StartTime.IsZero())
+	require.False(t, job.Status.EndTime.Before(job.Status.StartTime))
+}
+
+func TestJob_timeout(t *testing.T) {
+	job, err := NewJob(Command{Cmd: "sleep", Args: []string{"10"}, Timeout: 200 * time.Millisecond}, t.TempDir())
+	require.NoError(t, err)
+
+	start := time.Now()
+	require.NoError(t, job.Start())
+	job.Wait()
+
+	require.Less(t, time.Since(start), 5*time.Second)
+	require.Equal(t, JobStateTimedOut, job.Status.State)
+	require.Equal(t, syscall.SIGTERM, job.Status.Signal)
+}
+
+func TestJob_exitsBeforeTimeout(t *testing.T) {
+	job, err := NewJob(Command{Cmd: "true", Timeout: time.Minute}, t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, job.Start())
+	job.Wait()
+
+	require.Equal(t, JobStateSucceeded, job.Status.State)
+	require.Equal(t, 0, job.Status.ExitCode)
+}
+
+func TestJob_failed(t *testing.T) {
+	tests := []struct {
+		name       string
+		command    Command
+		wantCode   int
+		wantSignal syscall.Signal
+		wantError  string
+	}{
+		{
+			name:      "non-zero exit code",
+			command:   Command{Cmd: "sh", Args: []string{"-c", "exit 3"}},
+			wantCode:  3,
+			wantError: "exit status 3",
+		},
+		{
+			name:       "terminated by signal",
+			command:    Command{Cmd: "sh", Args: []string{"-c", "kill -KILL $$"}},
+			wantCode:   -1,
+			wantSignal: syscall.SIGKILL,
+			wantError:  "signal: killed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job, err := NewJob(tt.command, t.TempDir())
+			require.NoError(t, err)
+			require.NoError(t, job.Start())
+			job.Wait()
+
+			status := job.Query()
+			require.Equal(t, JobStateFailed, status.State)
+			require.Equal(t, tt.wantCode, status.ExitCode)
+			require.Equal(t, tt.wantSignal, status.Signal)
+			require.EqualError(t, status.ExitError, tt.wantError)
+		})
+	}
+}
+
+func TestJob_failedToStart(t *testing.T) {
+	job, err := NewJob(Command{Cmd: "jobrunner-nonexistent-command"}, t.TempDir())
+	require.NoError(t, err)
+	require.Error(t, job.Start())
+	job.Wait()
+
+	status := job.Query()
+	require.Equal(t, JobStateFailedToStart, status.State)
+	require.Contains(t, status.ExitError.Error(), "executable file not found")
+	require.True(t, status.StartTime.IsZero())
+	require.False(t, status.EndTime.IsZero())
+}
+
+func TestNewJob_invalidTimeout(t *testing.T) {
+	_, err := NewJob(Command{Cmd: "true", Timeout: -time.Second}, t.TempDir())
+	require.ErrorIs(t, err, ErrorInvalidCommand)
+}
+
+func TestJob_environment(t *testing.T) {
+	t.Setenv("JOBRUNNER_TEST_INHERITED", "inherited")
+	dir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		command  Command
+		wantLogs []string
+	}{
+		{
+			name:     "inherit environment",
+			command:  Command{Cmd: "sh", Args: []string{"-c", "echo $JOBRUNNER_TEST_INHERITED $FOO"}, Env: []string{"FOO=bar"}},
+			wantLogs: []string{"inherited bar"},
+		},
+		{
+			name:     "override inherited environment",
+			command:  Command{Cmd: "sh", Args: []string{"-c", "echo $JOBRUNNER_TEST_INHERITED"}, Env: []string{"JOBRUNNER_TEST_INHERITED=overridden"}},
+			wantLogs: []string{"overridden"},
+		},
+		{
+			// The artifacts directory is given to jobs whatever their environment
+			name:     "clear environment",
+			command:  Command{Cmd: "env", Args: []string{"-u", artifactsEnv}, Env: []string{"FOO=bar"}, ClearEnv: true},
+			wantLogs: []string{"FOO=bar"},
+		},
+		{
+			name:     "working directory",
+			command:  Command{Cmd: "pwd", Dir: dir},
+			wantLogs: []string{dir},
+		},
+		{
+			name:     "stdin",
+			command:  Command{Cmd: "cat", Stdin: []byte("some\ninput\n")},
+			wantLogs: []string{"some", "input"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job, err := NewJob(tt.command, t.TempDir())
+			require.NoError(t, err)
+			require.NoError(t, job.Start())
+			require.Equal(t, tt.wantLogs, readLogs(t, job))
+		})
+	}
+}
+
+func TestNewJob_invalidEnvironment(t *testing.T) {
+	_, err := NewJob(Command{Cmd: "env", Env: []string{"FOO"}}, t.TempDir())
+	require.ErrorIs(t, err, ErrorInvalidCommand)
+
+	_, err = NewJob(Command{Cmd: "pwd", Dir: "relative"}, t.TempDir())
+	require.ErrorIs(t, err, ErrorInvalidCommand)
 }
@@ -0,0 +1,170 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrorInvalidLabels      = errors.New("invalid labels")
+	ErrorInvalidAnnotations = errors.New("invalid annotations")
+	ErrorInvalidSelector    = errors.New("invalid label selector")
+)
+
+// maxAnnotationValue is the maximum size of the value of an annotation.
+const maxAnnotationValue = 4096
+
+var (
+	labelKeyRegexp   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]{0,61}[A-Za-z0-9])?$`)
+	labelValueRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]{0,63}$`)
+)
+
+// Selector matches jobs by their labels. The zero value matches all jobs.
+type Selector []requirement
+
+type requirement struct {
+	key      string
+	operator operator
+	value    string
+}
+
+type operator int
+
+const (
+	operatorEquals operator = iota
+	operatorNotEquals
+	operatorExists
+	operatorNotExists
+)
+
+// ParseSelector parses a comma separated list of requirements which must all be
+// satisfied by the labels of a job: "key=value" (or "key==value"),
+// "key!=value", "key" (the label is set) and "!key" (the label is not set).
+func ParseSelector(selector string) (Selector, error) {
+	var s Selector
+	if strings.TrimSpace(selector) == "" {
+		return s, nil
+	}
+
+	for _, term := range strings.Split(selector, ",") {
+		term = strings.TrimSpace(term)
+
+		var req requirement
+		if key, value, ok := strings.Cut(term, "!="); ok {
+			req = requirement{key: key, operator: operatorNotEquals, value: value}
+		} else if key, value, ok := strings.Cut(term, "=="); ok {
+			req = requirement{key: key, operator: operatorEquals, value: value}
+		} else if key, value, ok := strings.Cut(term, "="); ok {
+			req = requirement{key: key, operator: operatorEquals, value: value}
+		} else if strings.HasPrefix(term, "!") {
+			req = requirement{key: strings.TrimPrefix(term, "!"), operator: operatorNotExists}
+		} else {
+			req = requirement{key: term, operator: operatorExists}
+		}
+
+		req.key = strings.TrimSpace(req.key)
+		req.value = strings.TrimSpace(req.value)
+		if !labelKeyRegexp.MatchString(req.key) || !labelValueRegexp.MatchString(req.value) {
+			return nil, fmt.Errorf("%w: %q", ErrorInvalidSelector, term)
+		}
+		s = append(s, req)
+	}
+
+	return s, nil
+}
+
+// Matches reports whether the labels satisfy every requirement of the selector.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, req := range s {
+		value, ok := labels[req.key]
+		switch req.operator {
+		case operatorEquals:
+			if !ok || value != req.value {
+				return false
+			}
+		case operatorNotEquals:
+			if ok && value == req.value {
+				return false
+			}
+		case operatorExists:
+			if !ok {
+				return false
+			}
+		case operatorNotExists:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (s Selector) String() string {
+	terms := make([]string, len(s))
+	for i, req := range s {
+		switch req.operator {
+		case operatorEquals:
+			terms[i] = req.key + "=" + req.value
+		case operatorNotEquals:
+			terms[i] = req.key + "!=" + req.value
+		case operatorExists:
+			terms[i] = req.key
+		case operatorNotExists:
+			terms[i] = "!" + req.key
+		}
+	}
+	return strings.Join(terms, ",")
+}
+
+func validateLabels(labels map[string]string) error {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !labelKeyRegexp.MatchString(key) {
+			return fmt.Errorf("%w: key %q must be 1-63 alphanumeric, '.', '_', '-' or '/' characters and begin and end with an alphanumeric", ErrorInvalidLabels, key)
+		}
+		if !labelValueRegexp.MatchString(labels[key]) {
+			return fmt.Errorf("%w: value %q of %q must be at most 63 alphanumeric, '.', '_' or '-' characters", ErrorInvalidLabels, labels[key], key)
+		}
+	}
+	return nil
+}
+
+// validateAnnotations checks the keys of annotations like those of labels,
+// while their values may be any text of limited size.
+func validateAnnotations(annotations map[string]string) error {
+	keys := make([]string, 0, len(annotations))
+	for key := range annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !labelKeyRegexp.MatchString(key) {
+			return fmt.Errorf("%w: key %q must be 1-63 alphanumeric, '.', '_', '-' or '/' characters and begin and end with an alphanumeric", ErrorInvalidAnnotations, key)
+		}
+		if len(annotations[key]) > maxAnnotationValue {
+			return fmt.Errorf("%w: value of %q must be at most %d bytes", ErrorInvalidAnnotations, key, maxAnnotationValue)
+		}
+	}
+	return nil
+}
+
+// copyAnnotations copies annotations, leaving them nil when there are none.
+func copyAnnotations(annotations map[string]string) map[string]string {
+	if len(annotations) == 0 {
+		return nil
+	}
+	copied := make(map[string]string, len(annotations))
+	for key, value := range annotations {
+		copied[key] = value
+	}
+	return copied
+}
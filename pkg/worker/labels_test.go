@@ -0,0 +1,70 @@
+package worker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSelector(t *testing.T) {
+	labels := map[string]string{"team": "infra", "env": "staging", "ticket": "OPS-123"}
+
+	tests := []struct {
+		selector  string
+		wantMatch bool
+	}{
+		{selector: "", wantMatch: true},
+		{selector: "team=infra", wantMatch: true},
+		{selector: "team==infra", wantMatch: true},
+		{selector: "team=infra,env!=prod", wantMatch: true},
+		{selector: " team = infra , env != prod ", wantMatch: true},
+		{selector: "team=infra,env=prod", wantMatch: false},
+		{selector: "env!=staging", wantMatch: false},
+		{selector: "owner!=alice", wantMatch: true},
+		{selector: "ticket", wantMatch: true},
+		{selector: "pipeline", wantMatch: false},
+		{selector: "!pipeline", wantMatch: true},
+		{selector: "!ticket", wantMatch: false},
+		{selector: "pipeline=", wantMatch: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			selector, err := ParseSelector(tt.selector)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantMatch, selector.Matches(labels))
+		})
+	}
+}
+
+func TestParseSelector_invalid(t *testing.T) {
+	for _, selector := range []string{",", "team=infra,", "=infra", "team=in fra", "!", "team=a=b"} {
+		t.Run(selector, func(t *testing.T) {
+			_, err := ParseSelector(selector)
+			require.ErrorIs(t, err, ErrorInvalidSelector)
+		})
+	}
+}
+
+func TestSelector_String(t *testing.T) {
+	selector, err := ParseSelector("team==infra, env!=prod,ticket,!pipeline")
+	require.NoError(t, err)
+	require.Equal(t, "team=infra,env!=prod,ticket,!pipeline", selector.String())
+}
+
+func TestValidateLabels(t *testing.T) {
+	require.NoError(t, validateLabels(nil))
+	require.NoError(t, validateLabels(map[string]string{"team": "infra", "example.com/ticket": "OPS-123", "empty": ""}))
+	require.ErrorIs(t, validateLabels(map[string]string{"": "value"}), ErrorInvalidLabels)
+	require.ErrorIs(t, validateLabels(map[string]string{"-team": "infra"}), ErrorInvalidLabels)
+	require.ErrorIs(t, validateLabels(map[string]string{"team": "in fra"}), ErrorInvalidLabels)
+}
+
+func TestValidateAnnotations(t *testing.T) {
+	require.NoError(t, validateAnnotations(nil))
+	require.NoError(t, validateAnnotations(map[string]string{"example.com/commit": "0123abc", "note": "any text, even with spaces"}))
+	require.ErrorIs(t, validateAnnotations(map[string]string{"": "value"}), ErrorInvalidAnnotations)
+	require.ErrorIs(t, validateAnnotations(map[string]string{"-note": "value"}), ErrorInvalidAnnotations)
+	require.ErrorIs(t, validateAnnotations(map[string]string{"note": strings.Repeat("x", maxAnnotationValue+1)}), ErrorInvalidAnnotations)
+}
@@ -0,0 +1,200 @@
+package worker
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+var ErrorInvalidListOptions = errors.New("invalid list options")
+
+var errMalformedPageToken = fmt.Errorf("%w: malformed page token", ErrorInvalidListOptions)
+
+// JobFilter selects jobs. Zero values match all jobs.
+type JobFilter struct {
+	States   []JobState
+	Owner    string
+	Domain   string
+	Selector Selector
+	// CreatedAfter and CreatedBefore bound the creation time of the jobs.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+// ListOptions select the jobs returned by ListJobs.
+type ListOptions struct {
+	JobFilter
+	// PageSize is the maximum number of jobs returned, DefaultPageSize if zero
+	// and at most MaxPageSize.
+	PageSize int
+	// PageToken is the NextPageToken of the previous page, empty for the
+	// first page.
+	PageToken string
+}
+
+type JobSummary struct {
+	ID         string
+	Metadata   Metadata
+	Cmd        string
+	Args       []string
+	CreateTime time.Time
+	Status     JobStatus
+}
+
+// JobList is a page of jobs ordered by creation time and then ID. The
+// NextPageToken is empty on the last page.
+type JobList struct {
+	Jobs          []JobSummary
+	NextPageToken string
+}
+
+func (w *Worker) ListJobs(opts ListOptions) (JobList, error) {
+	pageSize := opts.PageSize
+	switch {
+	case pageSize < 0:
+		return JobList{}, fmt.Errorf("%w: page size must not be negative", ErrorInvalidListOptions)
+	case pageSize == 0:
+		pageSize = DefaultPageSize
+	case pageSize > MaxPageSize:
+		pageSize = MaxPageSize
+	}
+
+	var after *pageKey
+	if opts.PageToken != "" {
+		key, err := decodePageToken(opts.PageToken)
+		if err != nil {
+			return JobList{}, err
+		}
+		after = &key
+	}
+
+	records, err := w.store.List()
+	if err != nil {
+		return JobList{}, err
+	}
+
+	var jobs []JobSummary
+	for _, record := range records {
+		// Jobs run by the worker may have changed since they were recorded
+		summary := record.JobSummary
+		if job, ok := w.liveJob(record.ID); ok {
+			summary = job.summary()
+		}
+		if opts.match(summary) && (after == nil || after.before(summary)) {
+			jobs = append(jobs, summary)
+		}
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return keyOf(jobs[i]).before(jobs[j])
+	})
+
+	var list JobList
+	if len(jobs) > pageSize {
+		jobs = jobs[:pageSize]
+		list.NextPageToken = keyOf(jobs[pageSize-1]).encode()
+	}
+	list.Jobs = jobs
+	return list, nil
+}
+
+func (f JobFilter) match(job JobSummary) bool {
+	if len(f.States) > 0 && !containsState(f.States, job.Status.State) {
+		return false
+	}
+	if f.Owner != "" && f.Owner != job.Metadata.Owner {
+		return false
+	}
+	if f.Domain != "" && f.Domain != job.Metadata.Domain {
+		return false
+	}
+	if !f.Selector.Matches(job.Metadata.Labels) {
+		return false
+	}
+	if !f.CreatedAfter.IsZero() && !job.CreateTime.After(f.CreatedAfter) {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && !job.CreateTime.Before(f.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+func containsState(states []JobState, state JobState) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+func (j *Job) summary() JobSummary {
+	j.Lock()
+	defer j.Unlock()
+	return j.summaryLocked()
+}
+
+// summaryLocked returns the summary of the job, which must be locked.
+func (j *Job) summaryLocked() JobSummary {
+	return JobSummary{
+		ID:         j.ID,
+		Metadata:   j.Metadata,
+		Cmd:        j.command.Cmd,
+		Args:       j.command.Args,
+		CreateTime: j.CreateTime,
+		Status:     j.Status,
+	}
+}
+
+// pageKey is the position of a job in the list order. Page tokens encode the
+// key of the last job of a page, so pages stay stable as jobs are added.
+type pageKey struct {
+	createTime int64
+	id         string
+}
+
+func keyOf(job JobSummary) pageKey {
+	return pageKey{
+		createTime: job.CreateTime.UnixNano(),
+		id:         job.ID,
+	}
+}
+
+// before reports whether the key orders before the job.
+func (k pageKey) before(job JobSummary) bool {
+	other := keyOf(job)
+	if k.createTime != other.createTime {
+		return k.createTime < other.createTime
+	}
+	return k.id < other.id
+}
+
+func (k pageKey) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d/%s", k.createTime, k.id)))
+}
+
+func decodePageToken(token string) (pageKey, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return pageKey{}, errMalformedPageToken
+	}
+	createTime, id, ok := strings.Cut(string(data), "/")
+	if !ok {
+		return pageKey{}, errMalformedPageToken
+	}
+	nanos, err := strconv.ParseInt(createTime, 10, 64)
+	if err != nil {
+		return pageKey{}, errMalformedPageToken
+	}
+	return pageKey{createTime: nanos, id: id}, nil
+}
@@ -0,0 +1,143 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorker_ListJobs(t *testing.T) {
+	worker := NewWorker(t.TempDir())
+
+	succeeded, err := worker.StartJob(Command{Cmd: "true"}, Metadata{Owner: "alice", Labels: map[string]string{"team": "infra", "env": "prod"}})
+	require.NoError(t, err)
+	succeeded.Wait()
+
+	running, err := worker.StartJob(Command{Cmd: "sleep", Args: []string{"10"}}, Metadata{Owner: "bob", Domain: "research", Labels: map[string]string{"team": "infra"}})
+	require.NoError(t, err)
+	defer worker.StopJob(running.ID, StopOptions{})
+
+	tests := []struct {
+		name    string
+		opts    ListOptions
+		wantIDs []string
+	}{
+		{
+			name:    "all jobs in creation order",
+			opts:    ListOptions{},
+			wantIDs: []string{succeeded.ID, running.ID},
+		},
+		{
+			name:    "filter by state",
+			opts:    ListOptions{JobFilter: JobFilter{States: []JobState{JobStateRunning, JobStateFailed}}},
+			wantIDs: []string{running.ID},
+		},
+		{
+			name:    "filter by owner",
+			opts:    ListOptions{JobFilter: JobFilter{Owner: "alice"}},
+			wantIDs: []string{succeeded.ID},
+		},
+		{
+			name:    "filter by domain",
+			opts:    ListOptions{JobFilter: JobFilter{Domain: "research"}},
+			wantIDs: []string{running.ID},
+		},
+		{
+			name:    "filter by label selector",
+			opts:    ListOptions{JobFilter: JobFilter{Selector: mustParseSelector(t, "team=infra,env!=prod")}},
+			wantIDs: []string{running.ID},
+		},
+		{
+			name:    "filter by creation time",
+			opts:    ListOptions{JobFilter: JobFilter{CreatedAfter: succeeded.CreateTime}},
+			wantIDs: []string{running.ID},
+		},
+		{
+			name: "no matches",
+			opts: ListOptions{JobFilter: JobFilter{CreatedBefore: succeeded.CreateTime}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := worker.ListJobs(tt.opts)
+			require.NoError(t, err)
+			require.Empty(t, list.NextPageToken)
+
+			var ids []string
+			for _, job := range list.Jobs {
+				ids = append(ids, job.ID)
+			}
+			require.Equal(t, tt.wantIDs, ids)
+		})
+	}
+
+	list, err := worker.ListJobs(ListOptions{JobFilter: JobFilter{Owner: "alice"}})
+	require.NoError(t, err)
+	require.Len(t, list.Jobs, 1)
+	require.Equal(t, "true", list.Jobs[0].Cmd)
+	require.Equal(t, JobStateSucceeded, list.Jobs[0].Status.State)
+	require.Equal(t, map[string]string{"team": "infra", "env": "prod"}, list.Jobs[0].Metadata.Labels)
+}
+
+func TestWorker_ListJobsPagination(t *testing.T) {
+	worker := NewWorker(t.TempDir())
+
+	var wantIDs []string
+	for i := 0; i < 5; i++ {
+		job, err := worker.StartJob(Command{Cmd: "true"}, Metadata{})
+		require.NoError(t, err)
+		job.Wait()
+		wantIDs = append(wantIDs, job.ID)
+	}
+
+	var ids []string
+	opts := ListOptions{PageSize: 2}
+	for {
+		list, err := worker.ListJobs(opts)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(list.Jobs), 2)
+		for _, job := range list.Jobs {
+			ids = append(ids, job.ID)
+		}
+
+		if list.NextPageToken == "" {
+			break
+		}
+		opts.PageToken = list.NextPageToken
+
+		// Jobs created after a page was listed appear on later pages
+		if len(ids) == 2 {
+			job, err := worker.StartJob(Command{Cmd: "true"}, Metadata{})
+			require.NoError(t, err)
+			job.Wait()
+			wantIDs = append(wantIDs, job.ID)
+		}
+	}
+
+	require.Equal(t, wantIDs, ids)
+}
+
+func TestWorker_ListJobsInvalidOptions(t *testing.T) {
+	worker := NewWorker(t.TempDir())
+
+	_, err := worker.ListJobs(ListOptions{PageToken: "not a token"})
+	require.ErrorIs(t, err, ErrorInvalidListOptions)
+
+	_, err = worker.ListJobs(ListOptions{PageSize: -1})
+	require.ErrorIs(t, err, ErrorInvalidListOptions)
+}
+
+func TestPageToken(t *testing.T) {
+	key := pageKey{createTime: time.Now().UnixNano(), id: "8b1e1d2c-id"}
+	decoded, err := decodePageToken(key.encode())
+	require.NoError(t, err)
+	require.Equal(t, key, decoded)
+}
+
+func mustParseSelector(t *testing.T, selector string) Selector {
+	s, err := ParseSelector(selector)
+	require.NoError(t, err)
+	return s
+}
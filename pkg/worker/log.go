@@ -2,14 +2,100 @@ package worker
 
 import (
 	"bufio"
+	"errors"
 	"io"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/fsnotify/fsnotify"
 	"go.uber.org/zap"
 )
 
+// maxLogLine is the length after which the output of a command is split into
+// another line.
+const maxLogLine = 64 * 1024
+
+// LogStream is an output stream of a job.
+type LogStream int
+
+const (
+	// LogStreamAll selects both streams when following logs. It is also the
+	// stream of lines whose stream is unknown.
+	LogStreamAll LogStream = iota
+	LogStreamStdout
+	LogStreamStderr
+)
+
+// logHeader is the first line of log files whose lines are prefixed with the
+// tag of their stream. Log files without it were written before streams were
+// recorded, so the stream of their lines is unknown.
+const logHeader = "#jobrunner-log streams"
+
+// Lines in log files are prefixed with the tag of their stream. Untagged lines
+// are written by the init process itself, e.g. if it panics, so are stderr.
+var streamTags = map[LogStream]string{
+	LogStreamStdout: "O ",
+	LogStreamStderr: "E ",
+}
+
+// LogLine is a line of output of a job.
+type LogLine struct {
+	Stream LogStream
+	Text   string
+}
+
+func parseLogLine(line string) LogLine {
+	for stream, tag := range streamTags {
+		if strings.HasPrefix(line, tag) {
+			return LogLine{Stream: stream, Text: line[len(tag):]}
+		}
+	}
+	return LogLine{Stream: LogStreamStderr, Text: line}
+}
+
+// logWriter writes the lines of the output streams of a command to a log file,
+// tagged with their stream, in the order they are read.
+type logWriter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// copy writes the lines read from the stream until it is closed, ending a
+// trailing partial line.
+func (w *logWriter) copy(stream LogStream, r io.Reader) error {
+	reader := bufio.NewReaderSize(r, maxLogLine)
+	for {
+		line, err := reader.ReadSlice('\n')
+		if len(line) > 0 {
+			if writeErr := w.writeLine(stream, line); writeErr != nil {
+				return writeErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil && !errors.Is(err, bufio.ErrBufferFull) {
+			return err
+		}
+	}
+}
+
+func (w *logWriter) writeLine(stream LogStream, line []byte) error {
+	tagged := make([]byte, 0, len(line)+3)
+	tagged = append(tagged, streamTags[stream]...)
+	tagged = append(tagged, line...)
+	if line[len(line)-1] != '\n' {
+		tagged = append(tagged, '\n')
+	}
+
+	// Each line is written at once so lines of the streams are not mixed
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := w.out.Write(tagged)
+	return err
+}
+
 type LogFile struct {
 	file *os.File
 }
@@ -25,17 +111,32 @@ func NewLogFile(filepath string) (*LogFile, error) {
 	}, nil
 }
 
-func (l *LogFile) Follow(stopCh <-chan bool) (<-chan string, error) {
-	logCh := make(chan string)
+// errFollowCanceled is returned by readers of a followed log file once its
+// lines are no longer read.
+var errFollowCanceled = errors.New("following canceled")
+
+// Follow streams the lines of the log stream, or both streams if it is
+// LogStreamAll, until stopCh is closed once no more lines are written, or
+// until the returned cancel function is called once the lines are no longer
+// read. The log file is closed when following ends.
+func (l *LogFile) Follow(stopCh <-chan bool, logStream LogStream) (<-chan LogLine, CancelFunc, error) {
+	logCh := make(chan LogLine)
 
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	err = watcher.Add(l.file.Name())
 	if err != nil {
-		return nil, err
+		watcher.Close()
+		return nil, nil, err
+	}
+
+	cancelCh := make(chan struct{})
+	var cancelOnce sync.Once
+	cancel := func() {
+		cancelOnce.Do(func() { close(cancelCh) })
 	}
 
 	go func() {
@@ -43,66 +144,101 @@ func (l *LogFile) Follow(stopCh <-chan bool) (<-chan string, error) {
 			if closeErr := watcher.Close(); closeErr != nil {
 				zap.L().Error("error closing watcher", zap.Error(closeErr))
 			}
+			if closeErr := l.Close(); closeErr != nil {
+				zap.L().Error("error closing log file", zap.Error(closeErr))
+			}
 			close(logCh)
 		}()
 
+		reader := &lineReader{reader: bufio.NewReader(l.file), stream: logStream, cancelCh: cancelCh}
+
 		// Read all logs on initial file creation
-		if err = readAll(l.file, logCh); err != nil {
-			zap.L().Error("error reading log file", zap.String("file", l.file.Name()), zap.Error(err))
+		if err := reader.readAll(logCh); err != nil {
+			if !errors.Is(err, errFollowCanceled) {
+				zap.L().Error("error reading log file", zap.String("file", l.file.Name()), zap.Error(err))
+			}
+			return
 		}
 		// Watch for file write changes and read new lines
-		if err = stream(l.file, watcher, logCh, stopCh); err != nil {
+		if err := stream(reader, watcher, logCh, stopCh); err != nil && !errors.Is(err, errFollowCanceled) {
 			zap.L().Error("error reading log file line", zap.String("file", l.file.Name()), zap.Error(err))
 		}
 	}()
 
-	return logCh, nil
+	return logCh, cancel, nil
 }
 
+// Close closes the log file, if following has not already closed it.
 func (l *LogFile) Close() error {
-	return l.file.Close()
-}
-
-func readLine(reader *bufio.Reader) (string, error) {
-	line, err := reader.ReadString('\n')
-	if err != nil {
-		return "", err
+	if err := l.file.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+		return err
 	}
+	return nil
+}
 
-	return strings.TrimRight(line, "\n"), nil
+// lineReader reads complete lines of the stream, holding back a trailing
+// partial line until the rest of it has been written. The lines of log files
+// without a header are only read when following both streams.
+type lineReader struct {
+	reader  *bufio.Reader
+	stream  LogStream
+	partial string
+	// cancelCh is closed once the lines are no longer read.
+	cancelCh <-chan struct{}
+	// readHeader is whether the first line has been read, and tagged whether
+	// it was the header.
+	readHeader bool
+	tagged     bool
 }
 
-func readAll(file *os.File, lineCh chan<- string) error {
-	reader := bufio.NewReader(file)
+func (r *lineReader) readAll(lineCh chan<- LogLine) error {
 	for {
-		line, err := readLine(reader)
+		line, err := r.reader.ReadString('\n')
 		if err != nil {
 			if err == io.EOF {
-				break
+				r.partial += line
+				return nil
 			}
 			return err
 		}
-		lineCh <- line
+		text := strings.TrimRight(r.partial+line, "\n")
+		r.partial = ""
+		if !r.readHeader {
+			r.readHeader = true
+			if r.tagged = text == logHeader; r.tagged {
+				continue
+			}
+		}
+		logLine := LogLine{Stream: LogStreamAll, Text: text}
+		if r.tagged {
+			logLine = parseLogLine(text)
+		}
+		if r.stream == LogStreamAll || r.stream == logLine.Stream {
+			select {
+			case lineCh <- logLine:
+			case <-r.cancelCh:
+				return errFollowCanceled
+			}
+		}
 	}
-	return nil
 }
 
-func stream(file *os.File, watcher *fsnotify.Watcher, lineCh chan<- string, doneCh <-chan bool) error {
-	reader := bufio.NewReader(file)
+func stream(reader *lineReader, watcher *fsnotify.Watcher, lineCh chan<- LogLine, doneCh <-chan bool) error {
 	for {
 		select {
+		case <-reader.cancelCh:
+			return errFollowCanceled
 		case <-doneCh:
-			return nil
+			// Read anything written since the last write event
+			return reader.readAll(lineCh)
 		case event, ok := <-watcher.Events:
 			if !ok {
 				return nil
 			}
 			if event.Op&fsnotify.Write == fsnotify.Write {
-				line, err := readLine(reader)
-				if err != nil && err != io.EOF {
+				if err := reader.readAll(lineCh); err != nil {
 					return err
 				}
-				lineCh <- line
 			}
 		case watchErr := <-watcher.Errors:
 			return watchErr
@@ -2,8 +2,11 @@ package worker
 
 import (
 	"bufio"
+	"bytes"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -18,26 +21,142 @@ func TestLogFile_Follow(t *testing.T) {
 
 	writer := bufio.NewWriter(file)
 
-	const wantInitialLog = "some initial log"
-	const wantDelayedLog = "some delayed log"
+	wantInitialLog := LogLine{Stream: LogStreamStdout, Text: "some initial log"}
+	wantDelayedLog := LogLine{Stream: LogStreamStderr, Text: "some delayed log"}
 
 	// Write initial logs before follow
-	_, err = writer.WriteString(wantInitialLog + "\n")
+	_, err = writer.WriteString(logHeader + "\nO " + wantInitialLog.Text + "\n")
 	require.NoError(t, err)
 	require.NoError(t, writer.Flush())
 
 	// Follow and read initial logs
 	stopCh := make(chan bool)
-	defer func() { stopCh <- true }()
-	logCh, err := logFile.Follow(stopCh)
+	defer close(stopCh)
+	logCh, cancel, err := logFile.Follow(stopCh, LogStreamAll)
 	require.NoError(t, err)
+	defer cancel()
 	require.Equal(t, wantInitialLog, <-logCh)
 
 	// Write more logs and read on fsnotify write events
 	for i := 0; i < 10; i++ {
-		_, err = writer.WriteString(wantDelayedLog + "\n")
+		_, err = writer.WriteString("E " + wantDelayedLog.Text + "\n")
 		require.NoError(t, err)
 		require.NoError(t, writer.Flush())
 		require.Equal(t, wantDelayedLog, <-logCh)
 	}
 }
+
+func TestLogFile_FollowStream(t *testing.T) {
+	tagged := logHeader + "\nO out 1\nE err 1\nuntagged\nO out 2\n"
+	// Log files written before streams were recorded have no header
+	legacy := "O legacy\nlegacy\n"
+
+	tests := []struct {
+		log    string
+		stream LogStream
+		want   []LogLine
+	}{
+		{
+			log:    tagged,
+			stream: LogStreamAll,
+			want: []LogLine{
+				{Stream: LogStreamStdout, Text: "out 1"},
+				{Stream: LogStreamStderr, Text: "err 1"},
+				{Stream: LogStreamStderr, Text: "untagged"},
+				{Stream: LogStreamStdout, Text: "out 2"},
+			},
+		},
+		{
+			log:    tagged,
+			stream: LogStreamStdout,
+			want:   []LogLine{{Stream: LogStreamStdout, Text: "out 1"}, {Stream: LogStreamStdout, Text: "out 2"}},
+		},
+		{
+			log:    tagged,
+			stream: LogStreamStderr,
+			want:   []LogLine{{Stream: LogStreamStderr, Text: "err 1"}, {Stream: LogStreamStderr, Text: "untagged"}},
+		},
+		{
+			log:    legacy,
+			stream: LogStreamAll,
+			want:   []LogLine{{Stream: LogStreamAll, Text: "O legacy"}, {Stream: LogStreamAll, Text: "legacy"}},
+		},
+		{
+			log:    legacy,
+			stream: LogStreamStdout,
+		},
+		{
+			log:    legacy,
+			stream: LogStreamStderr,
+		},
+	}
+
+	for _, tt := range tests {
+		file, err := os.CreateTemp(t.TempDir(), logFilePattern)
+		require.NoError(t, err)
+		_, err = file.WriteString(tt.log)
+		require.NoError(t, err)
+
+		logFile, err := NewLogFile(file.Name())
+		require.NoError(t, err)
+		stopCh := make(chan bool)
+		close(stopCh)
+		logCh, cancel, err := logFile.Follow(stopCh, tt.stream)
+		require.NoError(t, err)
+		defer cancel()
+
+		var got []LogLine
+		for line := range logCh {
+			got = append(got, line)
+		}
+		require.Equal(t, tt.want, got, tt.stream)
+		// The log file is closed once following ends
+		_, err = logFile.file.Stat()
+		require.ErrorIs(t, err, os.ErrClosed)
+		require.NoError(t, logFile.Close())
+		require.NoError(t, file.Close())
+	}
+}
+
+func TestLogFile_FollowCancel(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), logFilePattern)
+	require.NoError(t, err)
+	defer file.Close()
+	_, err = file.WriteString(logHeader + "\n" + strings.Repeat("O line\n", 100))
+	require.NoError(t, err)
+
+	logFile, err := NewLogFile(file.Name())
+	require.NoError(t, err)
+	// The lines are no longer read before all of them are sent, e.g. as the
+	// client disconnected
+	logCh, cancel, err := logFile.Follow(make(chan bool), LogStreamAll)
+	require.NoError(t, err)
+	require.Equal(t, LogLine{Stream: LogStreamStdout, Text: "line"}, <-logCh)
+	cancel()
+
+	require.Eventually(t, func() bool {
+		select {
+		case _, ok := <-logCh:
+			return !ok
+		default:
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+	_, err = logFile.file.Stat()
+	require.ErrorIs(t, err, os.ErrClosed)
+}
+
+func TestLogWriter(t *testing.T) {
+	var out bytes.Buffer
+	writer := &logWriter{out: &out}
+
+	require.NoError(t, writer.copy(LogStreamStdout, strings.NewReader("one\n\ntwo")))
+	require.NoError(t, writer.copy(LogStreamStderr, strings.NewReader("three\n")))
+	require.Equal(t, "O one\nO \nO two\nE three\n", out.String())
+
+	// Long lines are split
+	out.Reset()
+	long := strings.Repeat("x", maxLogLine+10)
+	require.NoError(t, writer.copy(LogStreamStdout, strings.NewReader(long+"\n")))
+	require.Equal(t, "O "+long[:maxLogLine]+"\nO "+long[maxLogLine:]+"\n", out.String())
+}
@@ -0,0 +1,42 @@
+package worker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// PrepareLogDir creates the directory jobs write their files to if it does not
+// exist, and checks that only the worker can write to it, as the output of
+// jobs may be sensitive. Created directories can be searched by others, so that
+// jobs running as other users reach their artifacts directory.
+func PrepareLogDir(dir string) error {
+	if !filepath.IsAbs(dir) {
+		return fmt.Errorf("log directory %q must be an absolute path", dir)
+	}
+	if err := os.MkdirAll(dir, 0711); err != nil {
+		return fmt.Errorf("error creating log directory: %w", err)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("error checking log directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("log directory %q is not a directory", dir)
+	}
+	if info.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("log directory %q must not be writable by group or others, mode is %s", dir, info.Mode().Perm())
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Geteuid() {
+		return fmt.Errorf("log directory %q must be owned by the worker user %d, owner is %d", dir, os.Geteuid(), stat.Uid)
+	}
+
+	file, err := os.CreateTemp(dir, ".jobrunner_check_")
+	if err != nil {
+		return fmt.Errorf("log directory %q is not writable: %w", dir, err)
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
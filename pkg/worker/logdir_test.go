@@ -0,0 +1,46 @@
+package worker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepareLogDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs", "jobs")
+	require.NoError(t, PrepareLogDir(dir))
+
+	info, err := os.Stat(dir)
+	require.NoError(t, err)
+	require.True(t, info.IsDir())
+	require.Equal(t, os.FileMode(0711), info.Mode().Perm())
+
+	// Existing directories are accepted
+	require.NoError(t, PrepareLogDir(dir))
+}
+
+func TestPrepareLogDir_invalid(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0600))
+
+	writable := filepath.Join(t.TempDir(), "writable")
+	require.NoError(t, os.Mkdir(writable, 0700))
+	require.NoError(t, os.Chmod(writable, 0777))
+
+	tests := []struct {
+		name string
+		dir  string
+	}{
+		{name: "relative path", dir: "logs"},
+		{name: "not a directory", dir: file},
+		{name: "writable by others", dir: writable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Error(t, PrepareLogDir(tt.dir))
+		})
+	}
+}
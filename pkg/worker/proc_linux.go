@@ -0,0 +1,37 @@
+package worker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var errProcessExited = errors.New("process exited")
+
+// processStartTime returns the start time of the process in clock ticks after
+// boot, which identifies the process along with its PID as PIDs are reused.
+// Processes that exited but have not been reaped yet are reported as exited.
+func processStartTime(pid int) (uint64, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+
+	// The command name may contain spaces and parentheses, so the fields are
+	// split after the last parenthesis, starting with the state (field 3)
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 {
+		return 0, fmt.Errorf("malformed stat of process %d", pid)
+	}
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("malformed stat of process %d", pid)
+	}
+	if state := fields[0]; state == "Z" || state == "X" {
+		return 0, errProcessExited
+	}
+	return strconv.ParseUint(fields[19], 10, 64)
+}
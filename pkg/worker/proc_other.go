@@ -0,0 +1,11 @@
+//go:build !linux
+
+package worker
+
+import "errors"
+
+// processStartTime is unsupported, so jobs cannot be reattached after the
+// worker exits.
+func processStartTime(int) (uint64, error) {
+	return 0, errors.New("process start times are only supported on linux")
+}
@@ -0,0 +1,168 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// reattachPollInterval is how often the init process of a reattached job is
+// checked, as it is not a child of the worker so cannot be waited for.
+const reattachPollInterval = 200 * time.Millisecond
+
+var errJobLost = errors.New("the worker exited while the job was running and its exit status was not recorded")
+
+// Reconcile brings the records of jobs left incomplete by a previous worker,
+// such as one that crashed, up to date. Jobs whose init process is still
+// running are reattached, so that their logs can be followed, they can be
+// stopped and they complete once they exit. Jobs that are no longer running
+// are completed with the exit status recorded by their init process, or else
+// as lost. It must be called before any jobs are started.
+func (w *Worker) Reconcile() error {
+	records, err := w.store.List()
+	if err != nil {
+		return err
+	}
+
+	opts := newOptions(w.opts)
+	for _, record := range records {
+		if record.Status.State.Terminal() {
+			continue
+		}
+
+		job, err := reattachJob(record, opts)
+		if err != nil {
+			zap.L().Error("error reattaching job", zap.String("job", record.ID), zap.Error(err))
+			continue
+		}
+		w.jobs.Store(job.ID, job)
+
+		started := record.Status.State == JobStateRunning || record.Status.State == JobStateStarting
+		if started && processRunning(record.Pid, record.PidStartTime) {
+			// The init process of a starting job only survives the worker if
+			// it received its config, after which it starts the command
+			if job.Status.State == JobStateStarting {
+				job.Status.State = JobStateRunning
+				job.Status.StartTime = job.CreateTime
+				if err := w.store.Put(job.record()); err != nil {
+					zap.L().Error("error recording job", zap.String("job", job.ID), zap.Error(err))
+				}
+			}
+			zap.L().Info("reattached running job", zap.String("job", job.ID), zap.Int("pid", job.pid))
+			if job.command.Timeout > 0 {
+				// Timeouts count from the original start of the job
+				remaining := job.command.Timeout - time.Since(job.Status.StartTime)
+				if remaining < 0 {
+					remaining = 0
+				}
+				job.startTimer(remaining)
+			}
+			go job.watch()
+			continue
+		}
+
+		// The process group may have been reused since the init process
+		// exited, so it is not killed
+		job.pid = 0
+		job.completeFromExitFile()
+		zap.L().Info("completed job of previous worker", zap.String("job", job.ID), zap.Stringer("state", job.Query().State))
+	}
+
+	return nil
+}
+
+// reattachJob returns a job for the record of a job started by a previous
+// worker.
+func reattachJob(record JobRecord, opts options) (*Job, error) {
+	logFile, err := os.OpenFile(record.LogFile, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &Job{
+		ID:         record.ID,
+		Metadata:   record.Metadata,
+		CreateTime: record.CreateTime,
+		Status:     record.Status,
+		command: Command{
+			Cmd:     record.Cmd,
+			Args:    record.Args,
+			Timeout: record.Timeout,
+		},
+		opts:         opts,
+		dir:          record.Dir,
+		logFile:      logFile,
+		exitFile:     record.ExitFile,
+		pid:          record.Pid,
+		pidStartTime: record.PidStartTime,
+		scratch:      record.ScratchDir,
+		done:         make(chan struct{}),
+	}
+	if record.Cgroup != "" {
+		job.cgroup = &cgroup{path: record.Cgroup}
+	}
+	return job, nil
+}
+
+// watch completes a reattached job once its init process exits.
+func (j *Job) watch() {
+	ticker := time.NewTicker(reattachPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !processRunning(j.pid, j.pidStartTime) {
+			break
+		}
+	}
+
+	// Unlike a child, the init process is reaped before it is seen to exit,
+	// after which its process group may be reused, so descendants left behind
+	// by the command are not killed unless they are in the cgroup of the job,
+	// which is removed once it completes
+	j.Lock()
+	j.pid = 0
+	j.Unlock()
+	j.completeFromExitFile()
+}
+
+// completeFromExitFile completes a job whose init process exited while it was
+// not a child of the worker with the exit status in its exit file, or else as
+// lost.
+func (j *Job) completeFromExitFile() {
+	exit, ok := readExitFile(j.exitFile)
+	j.complete(func() {
+		if !ok {
+			j.Status.ExitError = errJobLost
+			return
+		}
+		j.setExitStatus(exit)
+	})
+}
+
+// readExitFile returns the exit status written to the file, if any.
+func readExitFile(file string) (initStatus, bool) {
+	var exit initStatus
+	if file == "" {
+		return exit, false
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return exit, false
+	}
+	if err := json.Unmarshal(data, &exit); err != nil {
+		return exit, false
+	}
+	return exit, exit.Exited
+}
+
+// processRunning reports whether the process with the PID is running and
+// started at the start time, i.e. the PID has not been reused.
+func processRunning(pid int, startTime uint64) bool {
+	if pid <= 0 {
+		return false
+	}
+	t, err := processStartTime(pid)
+	return err == nil && t == startTime
+}
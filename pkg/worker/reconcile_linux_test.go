@@ -0,0 +1,116 @@
+package worker
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorker_Reconcile(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "jobs.db")
+
+	// Kill a worker while its job is running
+	crashed := exec.Command(os.Args[0], "-test.run=^$")
+	crashed.Env = append(os.Environ(), crashWorkerEnv+"="+storePath)
+	stdout, err := crashed.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, crashed.Start())
+	jobID, err := bufio.NewReader(stdout).ReadString('\n')
+	require.NoError(t, err)
+	jobID = jobID[:len(jobID)-1]
+	require.NoError(t, crashed.Process.Kill())
+	_ = crashed.Wait()
+
+	store, err := OpenBoltStore(storePath)
+	require.NoError(t, err)
+	defer store.Close()
+	worker := NewWorker(filepath.Dir(storePath), WithJobStore(store))
+	require.NoError(t, worker.Reconcile())
+
+	// The job is reattached and completes with the exit status recorded by
+	// its init process
+	logCh, cancel, err := worker.FollowLogs(jobID, LogStreamAll)
+	require.NoError(t, err)
+	defer cancel()
+	var logs []string
+	for log := range logCh {
+		logs = append(logs, log.Text)
+	}
+	require.Equal(t, []string{"ready", "done"}, logs)
+
+	require.Eventually(t, func() bool {
+		status, err := worker.QueryJob(jobID)
+		return err == nil && status.State.Terminal()
+	}, 5*time.Second, 50*time.Millisecond)
+	status, err := worker.QueryJob(jobID)
+	require.NoError(t, err)
+	require.Equal(t, JobStateFailed, status.State)
+	require.Equal(t, 3, status.ExitCode)
+
+	record, err := store.Get(jobID)
+	require.NoError(t, err)
+	require.Equal(t, JobStateFailed, record.Status.State)
+	require.NoFileExists(t, record.ExitFile)
+}
+
+func TestWorker_ReconcileStop(t *testing.T) {
+	logDir := t.TempDir()
+	running := NewWorker(logDir)
+	job, err := running.StartJob(Command{
+		Cmd:  "sh",
+		Args: []string{"-c", "echo ready; while true; do sleep 0.1; done"},
+	}, Metadata{Owner: "alice"})
+	require.NoError(t, err)
+	defer running.StopJob(job.ID, StopOptions{})
+	waitForLog(t, job, "ready")
+
+	// Another worker reattaches to the running job and stops it
+	store := NewMemoryStore()
+	require.NoError(t, store.Put(job.record()))
+	worker := NewWorker(logDir, WithJobStore(store))
+	require.NoError(t, worker.Reconcile())
+
+	status, err := worker.QueryJob(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, JobStateRunning, status.State)
+	require.NoError(t, worker.StopJob(job.ID, StopOptions{}))
+	status, err = worker.QueryJob(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, JobStateStopped, status.State)
+}
+
+func TestWorker_ReconcileStarting(t *testing.T) {
+	logDir := t.TempDir()
+	running := NewWorker(logDir)
+	job, err := running.StartJob(Command{
+		Cmd:  "sh",
+		Args: []string{"-c", "echo ready; while true; do sleep 0.1; done"},
+	}, Metadata{Owner: "alice"})
+	require.NoError(t, err)
+	defer running.StopJob(job.ID, StopOptions{})
+	waitForLog(t, job, "ready")
+
+	// The worker exited after the init process was spawned but before the
+	// job was recorded as running
+	record := job.record()
+	record.Status.State = JobStateStarting
+	record.Status.StartTime = time.Time{}
+	store := NewMemoryStore()
+	require.NoError(t, store.Put(record))
+	worker := NewWorker(logDir, WithJobStore(store))
+	require.NoError(t, worker.Reconcile())
+
+	status, err := worker.QueryJob(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, JobStateRunning, status.State)
+	require.Equal(t, record.CreateTime, status.StartTime)
+	require.NoError(t, worker.StopJob(job.ID, StopOptions{}))
+	status, err = worker.QueryJob(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, JobStateStopped, status.State)
+}
@@ -0,0 +1,98 @@
+package worker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// crashWorkerEnv makes the test binary run a worker that starts a job, prints
+// its ID and then waits to be killed, recording jobs in the store of the path.
+const crashWorkerEnv = "JOBRUNNER_TEST_CRASH_WORKER"
+
+func runCrashWorker(storePath string) {
+	store, err := OpenBoltStore(storePath)
+	if err != nil {
+		panic(err)
+	}
+	worker := NewWorker(filepath.Dir(storePath), WithJobStore(store))
+	job, err := worker.StartJob(Command{
+		Cmd:  "sh",
+		Args: []string{"-c", "echo ready; sleep 1; echo done; exit 3"},
+	}, Metadata{Owner: "alice"})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(job.ID)
+	select {}
+}
+
+func TestWorker_ReconcileExited(t *testing.T) {
+	logDir := t.TempDir()
+	exitFile := filepath.Join(logDir, "exited.exit")
+	require.NoError(t, os.WriteFile(exitFile, []byte(`{"exited":true,"exit_code":-1,"signal":9}`), 0600))
+
+	tests := []struct {
+		name       string
+		record     JobRecord
+		wantState  JobState
+		wantSignal syscall.Signal
+	}{
+		{
+			name:       "exit status recorded",
+			record:     reconcileRecord(logDir, "exited", JobStateRunning, exitFile),
+			wantState:  JobStateFailed,
+			wantSignal: syscall.SIGKILL,
+		},
+		{
+			name:      "exit status not recorded",
+			record:    reconcileRecord(logDir, "lost", JobStateRunning, filepath.Join(logDir, "lost.exit")),
+			wantState: JobStateLost,
+		},
+		{
+			name:      "not started",
+			record:    reconcileRecord(logDir, "starting", JobStateStarting, ""),
+			wantState: JobStateLost,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			require.NoError(t, store.Put(tt.record))
+			worker := NewWorker(logDir, WithJobStore(store))
+			require.NoError(t, worker.Reconcile())
+
+			record, err := store.Get(tt.record.ID)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantState, record.Status.State)
+			require.Equal(t, tt.wantSignal, record.Status.Signal)
+			if tt.wantState == JobStateLost {
+				require.ErrorIs(t, record.Status.ExitError, errJobLost)
+			}
+			require.NoError(t, worker.StopJob(tt.record.ID, StopOptions{}))
+		})
+	}
+}
+
+// reconcileRecord returns the record of a job whose process has exited.
+func reconcileRecord(logDir string, id string, state JobState, exitFile string) JobRecord {
+	return JobRecord{
+		JobSummary: JobSummary{
+			ID:         id,
+			Cmd:        "true",
+			CreateTime: time.Now(),
+			Status:     JobStatus{State: state, StartTime: time.Now()},
+		},
+		LogFile:  filepath.Join(logDir, id+".log"),
+		ExitFile: exitFile,
+		// The process of the PID started at another time, as if the PID was
+		// reused
+		Pid: os.Getpid(),
+	}
+}
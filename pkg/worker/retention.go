@@ -0,0 +1,198 @@
+package worker
+
+import (
+	"errors"
+	"expvar"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const DefaultRetentionInterval = time.Minute
+
+var ErrorJobNotCompleted = errors.New("job not completed")
+
+var (
+	jobsDeleted       = expvar.NewInt("jobs_deleted_total")
+	logBytesReclaimed = expvar.NewInt("job_log_bytes_reclaimed_total")
+)
+
+// RetentionPolicy limits the completed jobs a worker keeps, which are deleted
+// oldest first along with their logs. Zero values are unlimited.
+type RetentionPolicy struct {
+	// MaxAge is how long jobs are kept after they complete.
+	MaxAge time.Duration
+	// MaxCount is the number of completed jobs kept.
+	MaxCount int
+	// MaxLogBytes is the total size of the logs of the completed jobs kept.
+	MaxLogBytes int64
+	// Interval is how often jobs are collected, DefaultRetentionInterval if
+	// zero.
+	Interval time.Duration
+}
+
+func (p RetentionPolicy) enabled() bool {
+	return p.MaxAge > 0 || p.MaxCount > 0 || p.MaxLogBytes > 0
+}
+
+// WithRetention sets the retention policy of completed jobs, which are kept
+// forever by default.
+func WithRetention(policy RetentionPolicy) Option {
+	return func(o *options) {
+		o.retention = policy
+	}
+}
+
+// DeleteJob deletes the record and directory of a completed job and returns
+// the size of the deleted files. The job is only deleted if authorize, unless
+// it is nil, returns no error for it, which is returned otherwise.
+func (w *Worker) DeleteJob(jobID string, authorize func(JobSummary) error) (int64, error) {
+	w.deleteMu.Lock()
+	defer w.deleteMu.Unlock()
+
+	job, err := w.DescribeJob(jobID)
+	if err != nil {
+		return 0, err
+	}
+	if authorize != nil {
+		if err := authorize(job); err != nil {
+			return 0, err
+		}
+	}
+	if !job.Status.State.Terminal() {
+		return 0, ErrorJobNotCompleted
+	}
+	record, err := w.store.Get(jobID)
+	if err != nil {
+		return 0, err
+	}
+	return w.deleteJob(record)
+}
+
+// deleteJob deletes the record and directory of the job. The worker must hold
+// deleteMu.
+func (w *Worker) deleteJob(record JobRecord) (int64, error) {
+	if err := w.store.Delete(record.ID); err != nil {
+		return 0, err
+	}
+	w.jobs.Delete(record.ID)
+
+	// Records without a directory predate the per job layout
+	var size int64
+	if record.Dir != "" {
+		size = dirSize(record.Dir)
+		if err := os.RemoveAll(record.Dir); err != nil {
+			zap.L().Error("error removing job directory", zap.String("dir", record.Dir), zap.Error(err))
+			size = 0
+		}
+	} else {
+		size = fileSize(record.LogFile)
+		if err := os.Remove(record.LogFile); err != nil && !os.IsNotExist(err) {
+			zap.L().Error("error removing job log file", zap.String("file", record.LogFile), zap.Error(err))
+			size = 0
+		}
+	}
+	jobsDeleted.Add(1)
+	logBytesReclaimed.Add(size)
+	return size, nil
+}
+
+// runCollector collects jobs every interval of the policy until stopCh is
+// closed.
+func (w *Worker) runCollector(policy RetentionPolicy, stopCh <-chan struct{}) {
+	interval := policy.Interval
+	if interval == 0 {
+		interval = DefaultRetentionInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case now := <-ticker.C:
+			w.collect(policy, now)
+		}
+	}
+}
+
+// collect deletes the oldest completed jobs until those left are within the
+// limits of the policy.
+func (w *Worker) collect(policy RetentionPolicy, now time.Time) {
+	w.deleteMu.Lock()
+	defer w.deleteMu.Unlock()
+
+	records, err := w.store.List()
+	if err != nil {
+		zap.L().Error("error listing jobs to collect", zap.Error(err))
+		return
+	}
+
+	var completed []JobRecord
+	sizes := map[string]int64{}
+	var totalSize int64
+	for _, record := range records {
+		if record.Status.State.Terminal() {
+			completed = append(completed, record)
+			sizes[record.ID] = fileSize(record.LogFile)
+			totalSize += sizes[record.ID]
+		}
+	}
+	sort.Slice(completed, func(i, j int) bool {
+		if !completed[i].Status.EndTime.Equal(completed[j].Status.EndTime) {
+			return completed[i].Status.EndTime.Before(completed[j].Status.EndTime)
+		}
+		return completed[i].ID < completed[j].ID
+	})
+
+	var deleted int
+	var reclaimed int64
+	for i, record := range completed {
+		expired := policy.MaxAge > 0 && now.Sub(record.Status.EndTime) > policy.MaxAge
+		tooMany := policy.MaxCount > 0 && len(completed)-i > policy.MaxCount
+		tooLarge := policy.MaxLogBytes > 0 && totalSize > policy.MaxLogBytes
+		if !expired && !tooMany && !tooLarge {
+			break
+		}
+
+		size, err := w.deleteJob(record)
+		if err != nil {
+			zap.L().Error("error deleting job", zap.String("job", record.ID), zap.Error(err))
+			return
+		}
+		totalSize -= sizes[record.ID]
+		deleted++
+		reclaimed += size
+	}
+
+	if deleted > 0 {
+		zap.L().Info("collected completed jobs", zap.Int("jobs", deleted), zap.Int64("reclaimed_bytes", reclaimed))
+	}
+}
+
+// dirSize returns the total size of the files in the directory.
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+func fileSize(file string) int64 {
+	info, err := os.Stat(file)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
@@ -0,0 +1,153 @@
+package worker
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorker_DeleteJob(t *testing.T) {
+	worker := NewWorker(t.TempDir())
+
+	running, err := worker.StartJob(Command{Cmd: "sleep", Args: []string{"10"}}, Metadata{})
+	require.NoError(t, err)
+	defer worker.StopJob(running.ID, StopOptions{})
+	_, err = worker.DeleteJob(running.ID, nil)
+	require.ErrorIs(t, err, ErrorJobNotCompleted)
+
+	completed, err := worker.StartJob(Command{Cmd: "echo", Args: []string{"hello"}}, Metadata{Owner: "alice"})
+	require.NoError(t, err)
+	completed.Wait()
+	size := dirSize(completed.dir)
+
+	// Jobs are only deleted if they are authorized
+	errDenied := errors.New("denied")
+	_, err = worker.DeleteJob(completed.ID, func(job JobSummary) error {
+		require.Equal(t, "alice", job.Metadata.Owner)
+		return errDenied
+	})
+	require.ErrorIs(t, err, errDenied)
+	require.DirExists(t, completed.dir)
+
+	reclaimed, err := worker.DeleteJob(completed.ID, func(JobSummary) error { return nil })
+	require.NoError(t, err)
+	require.Greater(t, size, int64(len("hello\n")))
+	require.Equal(t, size, reclaimed)
+	require.NoDirExists(t, completed.dir)
+	_, err = worker.DescribeJob(completed.ID)
+	require.ErrorIs(t, err, ErrorJobNotFound)
+
+	_, err = worker.DeleteJob(completed.ID, nil)
+	require.ErrorIs(t, err, ErrorJobNotFound)
+}
+
+func TestWorker_collect(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		policy  RetentionPolicy
+		wantIDs []string
+	}{
+		{
+			name:    "max age",
+			policy:  RetentionPolicy{MaxAge: 90 * time.Minute},
+			wantIDs: []string{"1h", "running"},
+		},
+		{
+			name:    "max count",
+			policy:  RetentionPolicy{MaxCount: 2},
+			wantIDs: []string{"1h", "2h", "running"},
+		},
+		{
+			name:    "max log bytes",
+			policy:  RetentionPolicy{MaxLogBytes: 250},
+			wantIDs: []string{"1h", "2h", "running"},
+		},
+		{
+			name:    "all limits",
+			policy:  RetentionPolicy{MaxAge: 150 * time.Minute, MaxCount: 2, MaxLogBytes: 50},
+			wantIDs: []string{"running"},
+		},
+		{
+			name:    "within limits",
+			policy:  RetentionPolicy{MaxAge: 4 * time.Hour, MaxCount: 3, MaxLogBytes: 300},
+			wantIDs: []string{"1h", "2h", "3h", "running"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logDir := t.TempDir()
+			store := NewMemoryStore()
+			for i, id := range []string{"1h", "2h", "3h"} {
+				record := collectRecord(t, logDir, id, JobStateSucceeded, 100)
+				record.Status.EndTime = now.Add(-time.Duration(i+1) * time.Hour)
+				require.NoError(t, store.Put(record))
+			}
+			require.NoError(t, store.Put(collectRecord(t, logDir, "running", JobStateRunning, 1000)))
+
+			worker := NewWorker(logDir, WithJobStore(store))
+			worker.collect(tt.policy, now)
+
+			records, err := store.List()
+			require.NoError(t, err)
+			var ids []string
+			for _, record := range records {
+				ids = append(ids, record.ID)
+			}
+			require.ElementsMatch(t, tt.wantIDs, ids)
+			for _, id := range []string{"1h", "2h", "3h"} {
+				_, err := os.Stat(filepath.Join(logDir, id+".log"))
+				require.Equal(t, containsString(tt.wantIDs, id), err == nil, id)
+			}
+		})
+	}
+}
+
+func TestWorker_collector(t *testing.T) {
+	worker := NewWorker(t.TempDir(), WithRetention(RetentionPolicy{MaxCount: 1, Interval: 10 * time.Millisecond}))
+	defer worker.Shutdown(StopOptions{})
+
+	first, err := worker.StartJob(Command{Cmd: "true"}, Metadata{})
+	require.NoError(t, err)
+	first.Wait()
+	second, err := worker.StartJob(Command{Cmd: "true"}, Metadata{})
+	require.NoError(t, err)
+	second.Wait()
+
+	require.Eventually(t, func() bool {
+		_, err := worker.DescribeJob(first.ID)
+		return err != nil
+	}, 2*time.Second, 10*time.Millisecond)
+	_, err = worker.DescribeJob(second.ID)
+	require.NoError(t, err)
+}
+
+// collectRecord returns the record of a job with a log file of the size.
+func collectRecord(t *testing.T, logDir string, id string, state JobState, logSize int) JobRecord {
+	logFile := filepath.Join(logDir, id+".log")
+	require.NoError(t, os.WriteFile(logFile, []byte(strings.Repeat("x", logSize)), 0600))
+	return JobRecord{
+		JobSummary: JobSummary{
+			ID:     id,
+			Cmd:    "true",
+			Status: JobStatus{State: state},
+		},
+		LogFile: logFile,
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package worker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxSymlinks is the number of symlinks followed in a path before it is
+// considered a loop, as in Linux.
+const maxSymlinks = 40
+
+// BindMount mounts a host path read-only into the root filesystem of a job.
+type BindMount struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+func validateRootFS(command Command) error {
+	if command.RootFS == "" {
+		if len(command.BindMounts) > 0 {
+			return fmt.Errorf("%w: bind mounts require a root filesystem", ErrorInvalidCommand)
+		}
+		return nil
+	}
+
+	if !filepath.IsAbs(command.RootFS) {
+		return fmt.Errorf("%w: root filesystem path %q must be absolute", ErrorInvalidCommand, command.RootFS)
+	}
+	if info, err := os.Stat(command.RootFS); err != nil || !info.IsDir() {
+		return fmt.Errorf("%w: root filesystem %q is not a directory", ErrorInvalidCommand, command.RootFS)
+	}
+
+	for _, mount := range command.BindMounts {
+		if !filepath.IsAbs(mount.Source) || !filepath.IsAbs(mount.Target) {
+			return fmt.Errorf("%w: bind mount paths %q and %q must be absolute", ErrorInvalidCommand, mount.Source, mount.Target)
+		}
+		// Targets are joined to the root filesystem, which they must not
+		// escape or replace
+		if filepath.Clean(mount.Target) != mount.Target || mount.Target == "/" {
+			return fmt.Errorf("%w: bind mount target %q must be a clean path below the root", ErrorInvalidCommand, mount.Target)
+		}
+		if _, err := os.Stat(mount.Source); err != nil {
+			return fmt.Errorf("%w: bind mount source: %v", ErrorInvalidCommand, err)
+		}
+	}
+
+	return nil
+}
+
+// secureJoin joins the path to root, resolving symlinks as if root were the
+// root filesystem, so that the result is never outside root even if the root
+// filesystem holds symlinks to host paths. Components that do not exist are
+// joined as they are.
+func secureJoin(root string, path string) (string, error) {
+	resolved := "/"
+	remaining := path
+	links := 0
+	for remaining != "" {
+		part, rest, _ := strings.Cut(strings.TrimLeft(remaining, "/"), "/")
+		remaining = rest
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+
+		next := filepath.Join(resolved, part)
+		info, err := os.Lstat(filepath.Join(root, next))
+		if os.IsNotExist(err) || err == nil && info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		links++
+		if links > maxSymlinks {
+			return "", fmt.Errorf("too many symlinks in %s", path)
+		}
+		dest, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(dest) {
+			resolved = "/"
+		}
+		remaining = dest + "/" + remaining
+	}
+	return filepath.Join(root, resolved), nil
+}
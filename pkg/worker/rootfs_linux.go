@@ -0,0 +1,106 @@
+package worker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+const pivotRootOldRoot = ".pivot_root"
+
+// mountRootFS mounts a writable overlay of rootfs at root, with the changes
+// stored in scratchDir, and bind mounts host paths into it read-only. The
+// artifacts directory is bind mounted writable at artifactsMountPoint.
+func mountRootFS(rootfs string, scratchDir string, root string, bindMounts []BindMount, artifacts string) error {
+	overlay := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s",
+		rootfs, filepath.Join(scratchDir, "upper"), filepath.Join(scratchDir, "work"))
+	if err := syscall.Mount("overlay", root, "overlay", 0, overlay); err != nil {
+		return fmt.Errorf("error mounting root filesystem overlay: %w", err)
+	}
+
+	for _, mount := range bindMounts {
+		// Symlinks in the root filesystem must not redirect mounts to the host
+		target, err := secureJoin(root, mount.Target)
+		if err != nil {
+			return fmt.Errorf("error resolving bind mount target %s: %w", mount.Target, err)
+		}
+		if err := createMountPoint(mount.Source, target); err != nil {
+			return fmt.Errorf("error creating bind mount target %s: %w", mount.Target, err)
+		}
+		if err := syscall.Mount(mount.Source, target, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return fmt.Errorf("error bind mounting %s: %w", mount.Source, err)
+		}
+		// Bind mounts can only be made read-only by remounting them
+		flags := uintptr(syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY)
+		if err := syscall.Mount("", target, "", flags, ""); err != nil {
+			return fmt.Errorf("error making bind mount %s read-only: %w", mount.Target, err)
+		}
+	}
+
+	if artifacts != "" {
+		target, err := secureJoin(root, artifactsMountPoint)
+		if err != nil {
+			return fmt.Errorf("error resolving artifacts mount point: %w", err)
+		}
+		if err := createMountPoint(artifacts, target); err != nil {
+			return fmt.Errorf("error creating artifacts mount point: %w", err)
+		}
+		if err := syscall.Mount(artifacts, target, "", syscall.MS_BIND, ""); err != nil {
+			return fmt.Errorf("error bind mounting artifacts directory: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func createMountPoint(source string, target string) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return os.MkdirAll(target, 0755)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(target, os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func mountProc(root string) error {
+	target := filepath.Join(root, "proc")
+	if err := os.MkdirAll(target, 0555); err != nil {
+		return fmt.Errorf("error creating /proc: %w", err)
+	}
+	if err := syscall.Mount("proc", target, "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("error mounting /proc: %w", err)
+	}
+	return nil
+}
+
+// pivotRoot makes root the root filesystem of the mount namespace and detaches
+// the old root filesystem.
+func pivotRoot(root string) error {
+	oldRoot := filepath.Join(root, pivotRootOldRoot)
+	if err := os.MkdirAll(oldRoot, 0700); err != nil {
+		return fmt.Errorf("error creating old root directory: %w", err)
+	}
+	if err := syscall.PivotRoot(root, oldRoot); err != nil {
+		return fmt.Errorf("error pivoting root filesystem: %w", err)
+	}
+	if err := os.Chdir("/"); err != nil {
+		return err
+	}
+
+	oldRoot = "/" + pivotRootOldRoot
+	if err := syscall.Unmount(oldRoot, syscall.MNT_DETACH); err != nil {
+		return fmt.Errorf("error unmounting old root filesystem: %w", err)
+	}
+	return os.Remove(oldRoot)
+}
@@ -0,0 +1,100 @@
+package worker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJob_rootFS(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("mounting a root filesystem requires root")
+	}
+
+	rootfs := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(rootfs, "marker"), []byte("rootfs"), 0644))
+	// Borrow the host binaries and libraries through read-only bind mounts
+	var bindMounts []BindMount
+	for _, dir := range []string{"/bin", "/lib", "/lib64", "/usr"} {
+		if path, err := filepath.EvalSymlinks(dir); err == nil && path != dir {
+			require.NoError(t, os.Symlink(path[1:], filepath.Join(rootfs, dir)))
+			continue
+		}
+		if _, err := os.Stat(dir); err == nil {
+			bindMounts = append(bindMounts, BindMount{Source: dir, Target: dir})
+		}
+	}
+
+	logDir := t.TempDir()
+	script := "cat /marker; echo; echo scratch > /scratch && cat /scratch; touch /usr/denied || echo read-only; echo artifact > \"$JOBRUNNER_ARTIFACTS/file\"; ls /" + pivotRootOldRoot
+	cmd := Command{
+		Cmd:        "/bin/sh",
+		Args:       []string{"-c", script},
+		RootFS:     rootfs,
+		BindMounts: bindMounts,
+	}
+	job, err := NewJob(cmd, logDir)
+	require.NoError(t, err)
+	require.NoError(t, job.Start())
+
+	logs := readLogs(t, job)
+	require.Contains(t, logs, "rootfs")
+	require.Contains(t, logs, "scratch")
+	require.Contains(t, logs, "read-only")
+	require.NotEqual(t, 0, job.Status.ExitCode, "old root should be detached")
+
+	data, err := os.ReadFile(filepath.Join(job.dir, artifactsDirName, "file"))
+	require.NoError(t, err)
+	require.Equal(t, "artifact\n", string(data))
+
+	// Changes are written to the scratch overlay, which is removed
+	_, err = os.Stat(filepath.Join(rootfs, "scratch"))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(job.scratch)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestNewJob_invalidRootFS(t *testing.T) {
+	tests := []struct {
+		name    string
+		command Command
+	}{
+		{
+			name:    "relative rootfs",
+			command: Command{Cmd: "sh", RootFS: "rootfs"},
+		},
+		{
+			name:    "missing rootfs",
+			command: Command{Cmd: "sh", RootFS: "/does/not/exist"},
+		},
+		{
+			name:    "bind mount without rootfs",
+			command: Command{Cmd: "sh", BindMounts: []BindMount{{Source: "/usr", Target: "/usr"}}},
+		},
+		{
+			name:    "relative bind mount target",
+			command: Command{Cmd: "sh", RootFS: t.TempDir(), BindMounts: []BindMount{{Source: "/usr", Target: "usr"}}},
+		},
+		{
+			name:    "bind mount target outside rootfs",
+			command: Command{Cmd: "sh", RootFS: t.TempDir(), BindMounts: []BindMount{{Source: "/usr", Target: "/../../etc"}}},
+		},
+		{
+			name:    "unclean bind mount target",
+			command: Command{Cmd: "sh", RootFS: t.TempDir(), BindMounts: []BindMount{{Source: "/usr", Target: "/usr/../etc"}}},
+		},
+		{
+			name:    "bind mount target root",
+			command: Command{Cmd: "sh", RootFS: t.TempDir(), BindMounts: []BindMount{{Source: "/usr", Target: "/"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewJob(tt.command, t.TempDir())
+			require.ErrorIs(t, err, ErrorInvalidCommand)
+		})
+	}
+}
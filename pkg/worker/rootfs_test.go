@@ -0,0 +1,41 @@
+package worker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecureJoin(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "etc", "app"), 0755))
+	require.NoError(t, os.Symlink("/etc", filepath.Join(root, "hostetc")))
+	require.NoError(t, os.Symlink("../../..", filepath.Join(root, "etc", "up")))
+	require.NoError(t, os.Symlink("app", filepath.Join(root, "etc", "current")))
+	require.NoError(t, os.Symlink("/loop", filepath.Join(root, "loop")))
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/etc/app", want: "/etc/app"},
+		{path: "/hostetc/passwd", want: "/etc/passwd"},
+		{path: "/etc/up/passwd", want: "/passwd"},
+		{path: "/../../passwd", want: "/passwd"},
+		{path: "/etc/current/config", want: "/etc/app/config"},
+		{path: "/missing/dir", want: "/missing/dir"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := secureJoin(root, tt.path)
+			require.NoError(t, err)
+			require.Equal(t, filepath.Join(root, tt.want), got)
+		})
+	}
+
+	_, err := secureJoin(root, "/loop")
+	require.Error(t, err)
+}
@@ -0,0 +1,118 @@
+package worker
+
+import (
+	"sync"
+	"time"
+)
+
+// JobRecord is the state of a job kept in a JobStore.
+type JobRecord struct {
+	JobSummary
+	// Dir is the directory holding the files of the job, which is removed
+	// when it is deleted.
+	Dir string
+	// LogFile is the path of the file holding the output of the job.
+	LogFile string
+	// ExitFile is the path of the file the exit status of the job is written
+	// to, from which it is recovered if the worker exited first.
+	ExitFile string
+	// Pid and PidStartTime identify the init process of a running job, so
+	// that it can be reattached after the worker exits.
+	Pid          int
+	PidStartTime uint64
+	// Cgroup and ScratchDir are the paths of the cgroup and root filesystem
+	// scratch directory of the job, if any, which are removed once it
+	// completes.
+	Cgroup     string
+	ScratchDir string
+	Timeout    time.Duration
+}
+
+// JobStore keeps the records of jobs, so that jobs can be described and their
+// logs followed after the worker that ran them is gone. A worker puts the
+// record of a job when it is created and whenever its state changes.
+type JobStore interface {
+	// Put creates or replaces the record of a job.
+	Put(record JobRecord) error
+	// Get returns the record of the job, or ErrorJobNotFound if it has none.
+	Get(jobID string) (JobRecord, error)
+	// List returns the records of all jobs in no particular order.
+	List() ([]JobRecord, error)
+	Delete(jobID string) error
+	Close() error
+}
+
+func (j *Job) record() JobRecord {
+	j.Lock()
+	defer j.Unlock()
+	return j.recordLocked()
+}
+
+// recordLocked returns the record of the job, which must be locked.
+func (j *Job) recordLocked() JobRecord {
+	record := JobRecord{
+		JobSummary:   j.summaryLocked(),
+		Dir:          j.dir,
+		LogFile:      j.logFile.Name(),
+		ExitFile:     j.exitFile,
+		Pid:          j.pid,
+		PidStartTime: j.pidStartTime,
+		ScratchDir:   j.scratch,
+		Timeout:      j.command.Timeout,
+	}
+	if j.cgroup != nil {
+		record.Cgroup = j.cgroup.path
+	}
+	return record
+}
+
+// MemoryStore is a JobStore holding records in memory, which are lost when
+// the worker process exits.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records map[string]JobRecord
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: map[string]JobRecord{},
+	}
+}
+
+func (s *MemoryStore) Put(record JobRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[record.ID] = record
+	return nil
+}
+
+func (s *MemoryStore) Get(jobID string) (JobRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, ok := s.records[jobID]
+	if !ok {
+		return JobRecord{}, ErrorJobNotFound
+	}
+	return record, nil
+}
+
+func (s *MemoryStore) List() ([]JobRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	records := make([]JobRecord, 0, len(s.records))
+	for _, record := range s.records {
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (s *MemoryStore) Delete(jobID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, jobID)
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,187 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var jobsBucket = []byte("jobs")
+
+// BoltStore is a JobStore holding records in a bbolt database file, so that
+// they survive restarts of the worker process.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// boltRecord is the encoding of a JobRecord in a BoltStore.
+type boltRecord struct {
+	ID           string            `json:"id"`
+	Owner        string            `json:"owner,omitempty"`
+	Domain       string            `json:"domain,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	Cmd          string            `json:"cmd"`
+	Args         []string          `json:"args,omitempty"`
+	CreateTime   time.Time         `json:"create_time"`
+	State        string            `json:"state"`
+	ExitCode     int               `json:"exit_code"`
+	ExitError    string            `json:"exit_error,omitempty"`
+	Signal       int               `json:"signal,omitempty"`
+	StartTime    time.Time         `json:"start_time"`
+	EndTime      time.Time         `json:"end_time"`
+	Dir          string            `json:"dir,omitempty"`
+	LogFile      string            `json:"log_file"`
+	ExitFile     string            `json:"exit_file,omitempty"`
+	Pid          int               `json:"pid,omitempty"`
+	PidStartTime uint64            `json:"pid_start_time,omitempty"`
+	Cgroup       string            `json:"cgroup,omitempty"`
+	ScratchDir   string            `json:"scratch_dir,omitempty"`
+	TimeoutMs    int64             `json:"timeout_ms,omitempty"`
+}
+
+// OpenBoltStore opens the bbolt database at the path, creating it if it does
+// not exist. The database is locked until the store is closed.
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening job store %q: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(jobsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Put(record JobRecord) error {
+	data, err := json.Marshal(encodeRecord(record))
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).Put([]byte(record.ID), data)
+	})
+}
+
+func (s *BoltStore) Get(jobID string) (JobRecord, error) {
+	var record JobRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(jobsBucket).Get([]byte(jobID))
+		if data == nil {
+			return ErrorJobNotFound
+		}
+		var err error
+		record, err = decodeRecord(data)
+		return err
+	})
+	return record, err
+}
+
+func (s *BoltStore) List() ([]JobRecord, error) {
+	var records []JobRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(_, data []byte) error {
+			record, err := decodeRecord(data)
+			if err != nil {
+				return err
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+	return records, err
+}
+
+func (s *BoltStore) Delete(jobID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).Delete([]byte(jobID))
+	})
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func encodeRecord(record JobRecord) boltRecord {
+	encoded := boltRecord{
+		ID:           record.ID,
+		Owner:        record.Metadata.Owner,
+		Domain:       record.Metadata.Domain,
+		Labels:       record.Metadata.Labels,
+		Annotations:  record.Metadata.Annotations,
+		Cmd:          record.Cmd,
+		Args:         record.Args,
+		CreateTime:   record.CreateTime,
+		State:        record.Status.State.String(),
+		ExitCode:     record.Status.ExitCode,
+		Signal:       int(record.Status.Signal),
+		StartTime:    record.Status.StartTime,
+		EndTime:      record.Status.EndTime,
+		Dir:          record.Dir,
+		LogFile:      record.LogFile,
+		ExitFile:     record.ExitFile,
+		Pid:          record.Pid,
+		PidStartTime: record.PidStartTime,
+		Cgroup:       record.Cgroup,
+		ScratchDir:   record.ScratchDir,
+		TimeoutMs:    record.Timeout.Milliseconds(),
+	}
+	if record.Status.ExitError != nil {
+		encoded.ExitError = record.Status.ExitError.Error()
+	}
+	return encoded
+}
+
+func decodeRecord(data []byte) (JobRecord, error) {
+	var encoded boltRecord
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return JobRecord{}, fmt.Errorf("error decoding job record: %w", err)
+	}
+	state, err := parseJobState(encoded.State)
+	if err != nil {
+		return JobRecord{}, fmt.Errorf("error decoding job record %s: %w", encoded.ID, err)
+	}
+
+	record := JobRecord{
+		JobSummary: JobSummary{
+			ID: encoded.ID,
+			Metadata: Metadata{
+				Owner:       encoded.Owner,
+				Domain:      encoded.Domain,
+				Labels:      encoded.Labels,
+				Annotations: encoded.Annotations,
+			},
+			Cmd:        encoded.Cmd,
+			Args:       encoded.Args,
+			CreateTime: encoded.CreateTime,
+			Status: JobStatus{
+				State:     state,
+				ExitCode:  encoded.ExitCode,
+				Signal:    syscall.Signal(encoded.Signal),
+				StartTime: encoded.StartTime,
+				EndTime:   encoded.EndTime,
+			},
+		},
+		Dir:          encoded.Dir,
+		LogFile:      encoded.LogFile,
+		ExitFile:     encoded.ExitFile,
+		Pid:          encoded.Pid,
+		PidStartTime: encoded.PidStartTime,
+		Cgroup:       encoded.Cgroup,
+		ScratchDir:   encoded.ScratchDir,
+		Timeout:      time.Duration(encoded.TimeoutMs) * time.Millisecond,
+	}
+	if encoded.ExitError != "" {
+		record.Status.ExitError = errors.New(encoded.ExitError)
+	}
+	return record, nil
+}
@@ -0,0 +1,127 @@
+package worker
+
+import (
+	"errors"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobStore(t *testing.T) {
+	tests := []struct {
+		name     string
+		newStore func(t *testing.T) JobStore
+	}{
+		{
+			name: "memory",
+			newStore: func(t *testing.T) JobStore {
+				return NewMemoryStore()
+			},
+		},
+		{
+			name: "bolt",
+			newStore: func(t *testing.T) JobStore {
+				store, err := OpenBoltStore(filepath.Join(t.TempDir(), "jobs.db"))
+				require.NoError(t, err)
+				return store
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := tt.newStore(t)
+			defer store.Close()
+
+			_, err := store.Get("1")
+			require.ErrorIs(t, err, ErrorJobNotFound)
+
+			record := testRecord("1")
+			require.NoError(t, store.Put(record))
+			got, err := store.Get("1")
+			require.NoError(t, err)
+			requireRecordEqual(t, record, got)
+
+			record.Status.State = JobStateFailed
+			record.Status.ExitCode = 1
+			record.Status.ExitError = errors.New("exit status 1")
+			require.NoError(t, store.Put(record))
+			require.NoError(t, store.Put(testRecord("2")))
+
+			records, err := store.List()
+			require.NoError(t, err)
+			require.Len(t, records, 2)
+			got, err = store.Get("1")
+			require.NoError(t, err)
+			requireRecordEqual(t, record, got)
+
+			require.NoError(t, store.Delete("1"))
+			_, err = store.Get("1")
+			require.ErrorIs(t, err, ErrorJobNotFound)
+		})
+	}
+}
+
+func TestBoltStore_reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.db")
+	store, err := OpenBoltStore(path)
+	require.NoError(t, err)
+	record := testRecord("1")
+	require.NoError(t, store.Put(record))
+	require.NoError(t, store.Close())
+
+	store, err = OpenBoltStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+	got, err := store.Get("1")
+	require.NoError(t, err)
+	requireRecordEqual(t, record, got)
+}
+
+func testRecord(id string) JobRecord {
+	now := time.Now()
+	return JobRecord{
+		JobSummary: JobSummary{
+			ID: id,
+			Metadata: Metadata{
+				Owner:       "alice",
+				Domain:      "default",
+				Labels:      map[string]string{"team": "infra"},
+				Annotations: map[string]string{"commit": "0123abc"},
+			},
+			Cmd:        "sleep",
+			Args:       []string{"10"},
+			CreateTime: now,
+			Status: JobStatus{
+				State:     JobStateStopped,
+				ExitCode:  -1,
+				Signal:    syscall.SIGTERM,
+				StartTime: now,
+				EndTime:   now.Add(time.Second),
+			},
+		},
+		LogFile: "/tmp/" + id + ".log",
+	}
+}
+
+// requireRecordEqual compares records ignoring the monotonic clock readings and
+// the type of exit errors, which are not kept by the bolt store.
+func requireRecordEqual(t *testing.T, want JobRecord, got JobRecord) {
+	require.True(t, want.CreateTime.Equal(got.CreateTime))
+	require.True(t, want.Status.StartTime.Equal(got.Status.StartTime))
+	require.True(t, want.Status.EndTime.Equal(got.Status.EndTime))
+	if want.Status.ExitError == nil {
+		require.NoError(t, got.Status.ExitError)
+	} else {
+		require.EqualError(t, got.Status.ExitError, want.Status.ExitError.Error())
+	}
+
+	for _, record := range []*JobRecord{&want, &got} {
+		record.CreateTime, record.Status.StartTime, record.Status.EndTime = time.Time{}, time.Time{}, time.Time{}
+		record.Status.ExitError = nil
+	}
+	require.Equal(t, want, got)
+}
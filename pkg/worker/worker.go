@@ -2,65 +2,304 @@ package worker
 
 import (
 	"errors"
+	"fmt"
+	"os"
+	"sort"
 	"sync"
+
+	"go.uber.org/zap"
 )
 
-var ErrorJobNotFound = errors.New("job not found")
+var (
+	ErrorJobNotFound    = errors.New("job not found")
+	ErrorInvalidCommand = errors.New("invalid command")
+	ErrorJobNotStarted  = errors.New("job not started")
+)
 
 type Worker struct {
-	jobs   sync.Map
-	logDir string
+	// jobs holds the jobs run by the worker, while store holds the records
+	// of every job including those run by previous workers.
+	jobs         sync.Map
+	store        JobStore
+	logDir       string
+	opts         []Option
+	eventHandler func(JobEvent)
+	// stopCollector stops collecting completed jobs, if they are collected.
+	stopCollector     chan struct{}
+	stopCollectorOnce sync.Once
+	// deleteMu serializes deleting jobs, so a job is authorized and deleted
+	// at once.
+	deleteMu sync.Mutex
+}
+
+type Option func(*options)
+
+type options struct {
+	cgroupRoot        string
+	defaultCredential *Credential
+	eventHandler      func(JobEvent)
+	store             JobStore
+	retention         RetentionPolicy
+}
+
+// WithCgroupRoot sets the mount point of the cgroup v2 hierarchy used to apply
+// job resource limits. Defaults to /sys/fs/cgroup.
+func WithCgroupRoot(path string) Option {
+	return func(o *options) {
+		o.cgroupRoot = path
+	}
+}
+
+// WithDefaultCredential sets the user jobs run as when their command does not
+// specify one.
+func WithDefaultCredential(credential Credential) Option {
+	return func(o *options) {
+		o.defaultCredential = &credential
+	}
+}
+
+// WithEventHandler sets a handler called with every job event. It is called
+// after the job is unlocked, with the events of each job in order, so events
+// of the job are delayed until it returns.
+func WithEventHandler(handler func(JobEvent)) Option {
+	return func(o *options) {
+		o.eventHandler = handler
+	}
+}
+
+// WithJobStore sets the store jobs are recorded in, a MemoryStore by default.
+func WithJobStore(store JobStore) Option {
+	return func(o *options) {
+		o.store = store
+	}
 }
 
-func NewWorker(logDir string) *Worker {
-	return &Worker{
-		jobs:   sync.Map{},
-		logDir: logDir,
+func newOptions(opts []Option) options {
+	o := options{
+		cgroupRoot: defaultCgroupRoot,
+	}
+	for _, opt := range opts {
+		opt(&o)
 	}
+	return o
 }
 
-func (w *Worker) StartJob(command Command) (*Job, error) {
-	job, err := NewJob(command, w.logDir)
+func NewWorker(logDir string, opts ...Option) *Worker {
+	o := newOptions(opts)
+	w := &Worker{
+		jobs:         sync.Map{},
+		store:        o.store,
+		logDir:       logDir,
+		eventHandler: o.eventHandler,
+	}
+	if w.store == nil {
+		w.store = NewMemoryStore()
+	}
+	// Jobs send their events to the worker, which records them before passing
+	// them on to the handler of the options
+	w.opts = append(append([]Option{}, opts...), WithEventHandler(w.handleEvent))
+
+	if o.retention.enabled() {
+		w.stopCollector = make(chan struct{})
+		go w.runCollector(o.retention, w.stopCollector)
+	}
+	return w
+}
+
+// StartJob creates, records and starts a job. A job whose command could not be
+// started is still returned, in state JobStateFailedToStart with the failure
+// as its exit error, as it is recorded like any other job.
+func (w *Worker) StartJob(command Command, metadata Metadata) (*Job, error) {
+	if err := validateLabels(metadata.Labels); err != nil {
+		return nil, err
+	}
+	if err := validateAnnotations(metadata.Annotations); err != nil {
+		return nil, err
+	}
+
+	job, err := NewJob(command, w.logDir, w.opts...)
 	if err != nil {
 		return nil, err
 	}
+	job.Metadata = Metadata{
+		Owner:       metadata.Owner,
+		Domain:      metadata.Domain,
+		Labels:      make(map[string]string, len(metadata.Labels)),
+		Annotations: copyAnnotations(metadata.Annotations),
+	}
+	for key, value := range metadata.Labels {
+		job.Metadata.Labels[key] = value
+	}
 
+	if err := job.writeMetadata(); err != nil {
+		job.logFile.Close()
+		os.RemoveAll(job.dir)
+		return nil, fmt.Errorf("error writing job metadata: %w", err)
+	}
+	if err := w.store.Put(job.record()); err != nil {
+		job.logFile.Close()
+		os.RemoveAll(job.dir)
+		return nil, fmt.Errorf("error recording job: %w", err)
+	}
 	w.jobs.Store(job.ID, job)
 
-	if err := job.Start(); err != nil {
-		return nil, err
-	}
+	// The failure is reported by the status of the job
+	_ = job.Start()
 
 	return job, nil
 }
 
-func (w *Worker) StopJob(jobID string) error {
-	if val, ok := w.jobs.Load(jobID); ok {
-		if job, ok := val.(*Job); ok && job != nil {
-			if err := job.cmd.Process.Kill(); err != nil {
-				return err
-			}
-			job.Wait()
-			return nil
+func (w *Worker) StopJob(jobID string, opts StopOptions) error {
+	if job, ok := w.liveJob(jobID); ok {
+		return job.Stop(opts)
+	}
+	// Jobs of previous workers are no longer running
+	_, err := w.store.Get(jobID)
+	return err
+}
+
+// StopJobs stops the running jobs that match the filter concurrently and
+// returns the IDs of the stopped jobs once they have completed. Jobs that are
+// not running yet are skipped. Jobs that could not be stopped do not prevent
+// the others from being stopped: the error joins a *StopJobError for each.
+func (w *Worker) StopJobs(filter JobFilter, opts StopOptions) ([]string, error) {
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		stopped []string
+		errs    []error
+	)
+
+	w.jobs.Range(func(_, val any) bool {
+		job, ok := val.(*Job)
+		if !ok || job == nil {
+			return true
 		}
+		if summary := job.summary(); summary.Status.State != JobStateRunning || !filter.match(summary) {
+			return true
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := job.Stop(opts)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, &StopJobError{JobID: job.ID, Err: err})
+				return
+			}
+			stopped = append(stopped, job.ID)
+		}()
+		return true
+	})
+
+	wg.Wait()
+	sort.Strings(stopped)
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].(*StopJobError).JobID < errs[j].(*StopJobError).JobID
+	})
+	return stopped, errors.Join(errs...)
+}
+
+// StopJobError is the error of a job that StopJobs could not stop.
+type StopJobError struct {
+	JobID string
+	Err   error
+}
+
+func (e *StopJobError) Error() string {
+	return fmt.Sprintf("error stopping job %s: %v", e.JobID, e.Err)
+}
+
+func (e *StopJobError) Unwrap() error {
+	return e.Err
+}
+
+// Shutdown stops collecting completed jobs and all running jobs concurrently,
+// and returns once they have completed. Jobs that are starting are waited for
+// and stopped too, rather than left running once the worker exits.
+func (w *Worker) Shutdown(opts StopOptions) error {
+	if w.stopCollector != nil {
+		w.stopCollectorOnce.Do(func() { close(w.stopCollector) })
 	}
-	return ErrorJobNotFound
+	w.jobs.Range(func(_, val any) bool {
+		if job, ok := val.(*Job); ok && job != nil && job.Query().State == JobStateStarting {
+			job.waitStarted()
+		}
+		return true
+	})
+	_, err := w.StopJobs(JobFilter{}, opts)
+	return err
 }
 
 func (w *Worker) QueryJob(jobID string) (JobStatus, error) {
+	job, err := w.DescribeJob(jobID)
+	if err != nil {
+		return JobStatus{}, err
+	}
+	return job.Status, nil
+}
+
+// DescribeJob returns the metadata, command and status of the job.
+func (w *Worker) DescribeJob(jobID string) (JobSummary, error) {
+	if job, ok := w.liveJob(jobID); ok {
+		return job.summary(), nil
+	}
+	record, err := w.store.Get(jobID)
+	if err != nil {
+		return JobSummary{}, err
+	}
+	return record.JobSummary, nil
+}
+
+// FollowLogs streams the lines of the stream of the job, or both streams if it
+// is LogStreamAll, until it completes. The logs of jobs of previous workers
+// are read to the end.
+func (w *Worker) FollowLogs(jobID string, stream LogStream) (<-chan LogLine, CancelFunc, error) {
+	if job, ok := w.liveJob(jobID); ok {
+		return job.FollowLogs(stream)
+	}
+	record, err := w.store.Get(jobID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logs, err := NewLogFile(record.LogFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The job is no longer running, so its logs are only read to the end
+	stopCh := make(chan bool)
+	close(stopCh)
+	logCh, cancel, err := logs.Follow(stopCh, stream)
+	if err != nil {
+		logs.Close()
+		return nil, nil, err
+	}
+	return logCh, cancel, nil
+}
+
+// liveJob returns the job if it was run by the worker.
+func (w *Worker) liveJob(jobID string) (*Job, bool) {
 	if val, ok := w.jobs.Load(jobID); ok {
 		if job, ok := val.(*Job); ok && job != nil {
-			return job.Status, nil
+			return job, true
 		}
 	}
-	return JobStatus{}, ErrorJobNotFound
+	return nil, false
 }
 
-func (w *Worker) FollowLogs(jobID string) (<-chan string, CancelFunc, error) {
-	if val, ok := w.jobs.Load(jobID); ok {
-		if job, ok := val.(*Job); ok && job != nil {
-			return job.FollowLogs()
+// handleEvent records the state of the job when the event was emitted, unless
+// the event does not change it, and passes the event on. The record is written
+// without the job locked, so that writing it does not block calls on the job.
+func (w *Worker) handleEvent(event JobEvent) {
+	if _, ok := w.liveJob(event.Job.ID); ok && event.Type != JobEventStopping {
+		if err := w.store.Put(event.record); err != nil {
+			zap.L().Error("error recording job", zap.String("job", event.Job.ID), zap.Error(err))
 		}
 	}
-	return nil, nil, ErrorJobNotFound
+	if w.eventHandler != nil {
+		w.eventHandler(event)
+	}
 }
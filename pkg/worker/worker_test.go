@@ -1,13 +1,26 @@
 package worker
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
 )
 
+func TestMain(m *testing.M) {
+	Init()
+	if store := os.Getenv(crashWorkerEnv); store != "" {
+		runCrashWorker(store)
+	}
+	os.Exit(m.Run())
+}
+
 func TestWorker_jobCompletes(t *testing.T) {
 	const wantLog = "test"
 	const numLogs = 10
@@ -17,7 +30,7 @@ func TestWorker_jobCompletes(t *testing.T) {
 
 	var jobID string
 	t.Run("start new job success", func(t *testing.T) {
-		job, err := worker.StartJob(echoLoop(numLogs, delay, wantLog))
+		job, err := worker.StartJob(echoLoop(numLogs, delay, wantLog), Metadata{})
 		require.NoError(t, err)
 		require.NotEmpty(t, job.ID)
 		jobID = job.ID
@@ -30,7 +43,7 @@ func TestWorker_jobCompletes(t *testing.T) {
 	})
 
 	t.Run("follow logs until job done", func(t *testing.T) {
-		logCh, _, err := worker.FollowLogs(jobID)
+		logCh, _, err := worker.FollowLogs(jobID, LogStreamAll)
 		require.NoError(t, err)
 		assertLogs(t, logCh, wantLog, numLogs)
 	})
@@ -38,7 +51,7 @@ func TestWorker_jobCompletes(t *testing.T) {
 	t.Run("query completed job success", func(t *testing.T) {
 		jobStatus, err := worker.QueryJob(jobID)
 		require.NoError(t, err)
-		require.Equal(t, JobStateCompleted, jobStatus.State)
+		require.Equal(t, JobStateSucceeded, jobStatus.State)
 		require.Equal(t, 0, jobStatus.ExitCode)
 	})
 }
@@ -52,7 +65,7 @@ func TestWorker_stopRunningJob(t *testing.T) {
 
 	var jobID string
 	t.Run("start new job success", func(t *testing.T) {
-		job, err := worker.StartJob(echoLoop(numLogs, delay, wantLog))
+		job, err := worker.StartJob(echoLoop(numLogs, delay, wantLog), Metadata{})
 		require.NoError(t, err)
 		require.NotEmpty(t, job.ID)
 		jobID = job.ID
@@ -65,7 +78,7 @@ func TestWorker_stopRunningJob(t *testing.T) {
 	})
 
 	t.Run("follow logs for 0.5 seconds", func(t *testing.T) {
-		logCh, cancel, err := worker.FollowLogs(jobID)
+		logCh, cancel, err := worker.FollowLogs(jobID, LogStreamAll)
 		require.NoError(t, err)
 
 		go func() {
@@ -74,24 +87,186 @@ func TestWorker_stopRunningJob(t *testing.T) {
 		}()
 
 		for log := range logCh {
-			require.Equal(t, wantLog, log)
+			require.Equal(t, wantLog, log.Text)
 		}
 	})
 
 	t.Run("stop running job success", func(t *testing.T) {
-		err := worker.StopJob(jobID)
+		err := worker.StopJob(jobID, StopOptions{})
 		require.NoError(t, err)
 	})
 
 	t.Run("query completed job success", func(t *testing.T) {
 		jobStatus, err := worker.QueryJob(jobID)
 		require.NoError(t, err)
-		require.Equal(t, JobStateCompleted, jobStatus.State)
+		require.Equal(t, JobStateStopped, jobStatus.State)
 		require.Equal(t, -1, jobStatus.ExitCode)
-		require.Contains(t, jobStatus.ExitError.Error(), "signal: killed")
+		require.Equal(t, syscall.SIGTERM, jobStatus.Signal)
+		require.Contains(t, jobStatus.ExitError.Error(), "signal: terminated")
 	})
 }
 
+func TestWorker_stopJobEscalation(t *testing.T) {
+	worker := NewWorker(t.TempDir())
+
+	// The job ignores SIGTERM so it is only stopped by the SIGKILL sent after
+	// the grace period
+	job, err := worker.StartJob(Command{
+		Cmd:  "sh",
+		Args: []string{"-c", "trap '' TERM; echo ready; while true; do sleep 0.1; done"},
+	}, Metadata{})
+	require.NoError(t, err)
+	waitForLog(t, job, "ready")
+
+	start := time.Now()
+	err = worker.StopJob(job.ID, StopOptions{GracePeriod: 200 * time.Millisecond})
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+
+	jobStatus, err := worker.QueryJob(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, JobStateStopped, jobStatus.State)
+	require.Equal(t, syscall.SIGKILL, jobStatus.Signal)
+}
+
+func TestWorker_stopJobSignal(t *testing.T) {
+	worker := NewWorker(t.TempDir())
+
+	job, err := worker.StartJob(Command{
+		Cmd:  "sh",
+		Args: []string{"-c", "trap 'echo interrupted; exit 3' INT; echo ready; while true; do sleep 0.1; done"},
+	}, Metadata{})
+	require.NoError(t, err)
+	waitForLog(t, job, "ready")
+
+	err = worker.StopJob(job.ID, StopOptions{Signal: syscall.SIGINT, GracePeriod: 5 * time.Second})
+	require.NoError(t, err)
+
+	jobStatus, err := worker.QueryJob(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, 3, jobStatus.ExitCode)
+	require.Zero(t, jobStatus.Signal)
+	require.Contains(t, readLogs(t, job), "interrupted")
+}
+
+func TestWorker_stopJobNotFound(t *testing.T) {
+	worker := NewWorker(t.TempDir())
+	err := worker.StopJob("unknown", StopOptions{})
+	require.ErrorIs(t, err, ErrorJobNotFound)
+}
+
+func TestWorker_shutdown(t *testing.T) {
+	worker := NewWorker(t.TempDir())
+
+	var jobs []*Job
+	for i := 0; i < 3; i++ {
+		job, err := worker.StartJob(echoLoop(100, 0.1, "test"), Metadata{})
+		require.NoError(t, err)
+		jobs = append(jobs, job)
+	}
+
+	require.NoError(t, worker.Shutdown(StopOptions{}))
+
+	for _, job := range jobs {
+		jobStatus, err := worker.QueryJob(job.ID)
+		require.NoError(t, err)
+		require.Equal(t, JobStateStopped, jobStatus.State)
+		require.Equal(t, syscall.SIGTERM, jobStatus.Signal)
+	}
+}
+
+func TestWorker_StartJobInvalidLabels(t *testing.T) {
+	worker := NewWorker(t.TempDir())
+	_, err := worker.StartJob(Command{Cmd: "true"}, Metadata{Labels: map[string]string{"team": "in fra"}})
+	require.ErrorIs(t, err, ErrorInvalidLabels)
+	_, err = worker.StartJob(Command{Cmd: "true"}, Metadata{Annotations: map[string]string{"in fra": "team"}})
+	require.ErrorIs(t, err, ErrorInvalidAnnotations)
+}
+
+func TestWorker_StartJobFailedToStart(t *testing.T) {
+	worker := NewWorker(t.TempDir())
+	job, err := worker.StartJob(Command{Cmd: "jobrunner-nonexistent-command"}, Metadata{Owner: "alice"})
+	require.NoError(t, err)
+	require.Equal(t, JobStateFailedToStart, job.Query().State)
+	require.ErrorContains(t, job.Query().ExitError, "executable file not found")
+
+	// The job is recorded like any other
+	status, err := worker.QueryJob(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, JobStateFailedToStart, status.State)
+}
+
+func TestWorker_DescribeJob(t *testing.T) {
+	worker := NewWorker(t.TempDir())
+	labels := map[string]string{"team": "infra"}
+	annotations := map[string]string{"commit": "0123abc"}
+	job, err := worker.StartJob(Command{Cmd: "true", Args: []string{"arg"}}, Metadata{Owner: "alice", Labels: labels, Annotations: annotations})
+	require.NoError(t, err)
+	job.Wait()
+
+	// Labels and annotations are copied when the job starts
+	labels["team"] = "changed"
+	annotations["commit"] = "changed"
+
+	summary, err := worker.DescribeJob(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, job.ID, summary.ID)
+	require.Equal(t, Metadata{
+		Owner:       "alice",
+		Labels:      map[string]string{"team": "infra"},
+		Annotations: map[string]string{"commit": "0123abc"},
+	}, summary.Metadata)
+	require.Equal(t, "true", summary.Cmd)
+	require.Equal(t, []string{"arg"}, summary.Args)
+	require.Equal(t, JobStateSucceeded, summary.Status.State)
+
+	_, err = worker.DescribeJob("unknown")
+	require.ErrorIs(t, err, ErrorJobNotFound)
+}
+
+func TestWorker_StopJobs(t *testing.T) {
+	worker := NewWorker(t.TempDir())
+
+	start := func(labels map[string]string) *Job {
+		job, err := worker.StartJob(echoLoop(100, 0.1, "test"), Metadata{Labels: labels})
+		require.NoError(t, err)
+		return job
+	}
+	infra := start(map[string]string{"team": "infra", "env": "staging"})
+	prod := start(map[string]string{"team": "infra", "env": "prod"})
+	other := start(map[string]string{"team": "web"})
+	defer worker.Shutdown(StopOptions{})
+	// Jobs that are not running yet are skipped
+	queued, err := NewJob(echoLoop(1, 0, "test"), t.TempDir())
+	require.NoError(t, err)
+	defer queued.logFile.Close()
+	queued.Metadata = Metadata{Labels: map[string]string{"team": "infra"}}
+	worker.jobs.Store(queued.ID, queued)
+
+	stopped, err := worker.StopJobs(JobFilter{Selector: mustParseSelector(t, "team=infra,env!=prod")}, StopOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{infra.ID}, stopped)
+
+	require.Equal(t, JobStateStopped, infra.Query().State)
+	require.Equal(t, JobStateQueued, queued.Query().State)
+	require.Equal(t, JobStateRunning, prod.Query().State)
+	require.Equal(t, JobStateRunning, other.Query().State)
+}
+
+// waitForLog blocks until the job writes the log line, so that it is known to
+// be running its command (e.g. signal handlers are installed).
+func waitForLog(t *testing.T, job *Job, want string) {
+	logCh, cancel, err := job.FollowLogs(LogStreamAll)
+	require.NoError(t, err)
+	defer cancel()
+	for log := range logCh {
+		if log.Text == want {
+			return
+		}
+	}
+	t.Fatalf("job completed without logging %q", want)
+}
+
 func TestWorker_concurrentLogFollowers(t *testing.T) {
 	const wantLog = "test"
 	const numLogs = 10
@@ -99,31 +274,308 @@ func TestWorker_concurrentLogFollowers(t *testing.T) {
 
 	worker := NewWorker(t.TempDir())
 
-	job, err := worker.StartJob(echoLoop(numLogs, delay, wantLog))
+	job, err := worker.StartJob(echoLoop(numLogs, delay, wantLog), Metadata{})
 	require.NoError(t, err)
 
-	logCh1, _, err := worker.FollowLogs(job.ID)
+	logCh1, _, err := worker.FollowLogs(job.ID, LogStreamAll)
 	require.NoError(t, err)
-	logCh2, _, err := worker.FollowLogs(job.ID)
+	logCh2, _, err := worker.FollowLogs(job.ID, LogStreamAll)
 	require.NoError(t, err)
 
 	go func() { assertLogs(t, logCh1, wantLog, numLogs) }()
 	go func() { assertLogs(t, logCh2, wantLog, numLogs) }()
 }
 
-func assertLogs(t *testing.T, logCh <-chan string, wantLog string, numLogs int) {
+func assertLogs(t *testing.T, logCh <-chan LogLine, wantLog string, numLogs int) {
 	gotLogs := 0
 	for log := range logCh {
-		require.Equal(t, wantLog, log)
+		require.Equal(t, wantLog, log.Text)
 		gotLogs++
 	}
 
 	require.Equal(t, numLogs, gotLogs)
 }
 
+func readLogs(t *testing.T, job *Job) []string {
+	logCh, _, err := job.FollowLogs(LogStreamAll)
+	require.NoError(t, err)
+
+	var logs []string
+	for log := range logCh {
+		logs = append(logs, log.Text)
+	}
+	return logs
+}
+
 func echoLoop(iterations int, delay float64, echo string) Command {
 	return Command{
 		Cmd:  "bash",
 		Args: []string{"-c", fmt.Sprintf("for i in {1..%d}; do echo %s; sleep %f; done", iterations, echo, delay)},
 	}
 }
+
+func TestWorker_jobDirectory(t *testing.T) {
+	logDir := t.TempDir()
+	worker := NewWorker(logDir)
+
+	job, err := worker.StartJob(Command{Cmd: "echo", Args: []string{"hello"}}, Metadata{Owner: "alice"})
+	require.NoError(t, err)
+	job.Wait()
+
+	dir := filepath.Join(logDir, job.ID)
+	info, err := os.Stat(dir)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0711), info.Mode().Perm())
+
+	for _, name := range []string{logFileName, metadataFileName} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0600), info.Mode().Perm(), name)
+	}
+	require.NoFileExists(t, filepath.Join(dir, exitFileName))
+	info, err = os.Stat(filepath.Join(dir, artifactsDirName))
+	require.NoError(t, err)
+	require.True(t, info.IsDir())
+	require.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	data, err := os.ReadFile(filepath.Join(dir, logFileName))
+	require.NoError(t, err)
+	require.Equal(t, logHeader+"\nO hello\n", string(data))
+
+	data, err = os.ReadFile(filepath.Join(dir, metadataFileName))
+	require.NoError(t, err)
+	var metadata jobMetadata
+	require.NoError(t, json.Unmarshal(data, &metadata))
+	require.Equal(t, job.ID, metadata.ID)
+	require.Equal(t, "alice", metadata.Owner)
+	require.Equal(t, "echo", metadata.Cmd)
+	require.Equal(t, []string{"hello"}, metadata.Args)
+}
+
+func TestWorker_logStreams(t *testing.T) {
+	const lines = 100
+	worker := NewWorker(t.TempDir())
+	job, err := worker.StartJob(Command{
+		Cmd:  "bash",
+		Args: []string{"-c", fmt.Sprintf("for i in $(seq %d); do echo out $i; echo err $i >&2; done; printf 'no newline' >&2", lines)},
+	}, Metadata{})
+	require.NoError(t, err)
+	job.Wait()
+
+	var wantStdout, wantStderr []LogLine
+	for i := 1; i <= lines; i++ {
+		wantStdout = append(wantStdout, LogLine{Stream: LogStreamStdout, Text: fmt.Sprintf("out %d", i)})
+		wantStderr = append(wantStderr, LogLine{Stream: LogStreamStderr, Text: fmt.Sprintf("err %d", i)})
+	}
+	wantStderr = append(wantStderr, LogLine{Stream: LogStreamStderr, Text: "no newline"})
+
+	followLogs := func(stream LogStream) []LogLine {
+		logCh, cancel, err := worker.FollowLogs(job.ID, stream)
+		require.NoError(t, err)
+		defer cancel()
+		var logs []LogLine
+		for log := range logCh {
+			logs = append(logs, log)
+		}
+		return logs
+	}
+	require.Equal(t, wantStdout, followLogs(LogStreamStdout))
+	require.Equal(t, wantStderr, followLogs(LogStreamStderr))
+
+	// Both streams are followed together with the lines of each in order,
+	// although their interleaving is best-effort
+	var gotStdout, gotStderr []LogLine
+	for _, log := range followLogs(LogStreamAll) {
+		if log.Stream == LogStreamStdout {
+			gotStdout = append(gotStdout, log)
+		} else {
+			gotStderr = append(gotStderr, log)
+		}
+	}
+	require.Equal(t, wantStdout, gotStdout)
+	require.Equal(t, wantStderr, gotStderr)
+}
+
+func TestWorker_eventHandler(t *testing.T) {
+	var mu sync.Mutex
+	var events []JobEvent
+	var states []JobState
+	var worker *Worker
+	worker = NewWorker(t.TempDir(), WithEventHandler(func(event JobEvent) {
+		// The job is not locked while the handler is called
+		status, err := worker.QueryJob(event.Job.ID)
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+		if err == nil {
+			states = append(states, status.State)
+		}
+	}))
+
+	job, err := worker.StartJob(Command{
+		Cmd:  "sh",
+		Args: []string{"-c", "echo ready; while true; do sleep 0.1; done"},
+	}, Metadata{Owner: "alice", Domain: "team-a"})
+	require.NoError(t, err)
+	waitForLog(t, job, "ready")
+	require.NoError(t, worker.StopJob(job.ID, StopOptions{}))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, events, 4)
+	require.Equal(t, JobEventStarting, events[0].Type)
+	require.Equal(t, JobStateStarting, events[0].Job.Status.State)
+	require.Equal(t, JobEventStarted, events[1].Type)
+	require.Equal(t, JobStateRunning, events[1].Job.Status.State)
+	require.Equal(t, "alice", events[1].Job.Metadata.Owner)
+	require.Equal(t, "team-a", events[1].Job.Metadata.Domain)
+	require.Equal(t, JobEventStopping, events[2].Type)
+	require.Equal(t, syscall.SIGTERM, events[2].Signal)
+	require.Equal(t, JobStateStopped, events[2].StopState)
+	require.Equal(t, JobEventCompleted, events[3].Type)
+	require.Equal(t, JobStateStopped, events[3].Job.Status.State)
+	require.Equal(t, job.ID, events[3].Job.ID)
+	require.Len(t, states, 4)
+}
+
+func TestWorker_jobStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.db")
+	logDir := t.TempDir()
+	store, err := OpenBoltStore(path)
+	require.NoError(t, err)
+	worker := NewWorker(logDir, WithJobStore(store))
+
+	job, err := worker.StartJob(echoLoop(2, 0, "hello"), Metadata{Owner: "alice", Labels: map[string]string{"team": "infra"}})
+	require.NoError(t, err)
+	job.Wait()
+	want, err := worker.DescribeJob(job.ID)
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	// A new worker describes and lists the job and reads its logs
+	store, err = OpenBoltStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+	worker = NewWorker(logDir, WithJobStore(store))
+
+	got, err := worker.DescribeJob(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, JobStateSucceeded, got.Status.State)
+	require.Equal(t, want.Metadata, got.Metadata)
+	require.Equal(t, want.Cmd, got.Cmd)
+	require.Equal(t, want.Args, got.Args)
+	require.True(t, want.Status.EndTime.Equal(got.Status.EndTime))
+
+	list, err := worker.ListJobs(ListOptions{JobFilter: JobFilter{Owner: "alice"}})
+	require.NoError(t, err)
+	require.Len(t, list.Jobs, 1)
+	require.Equal(t, job.ID, list.Jobs[0].ID)
+
+	logCh, cancel, err := worker.FollowLogs(job.ID, LogStreamAll)
+	require.NoError(t, err)
+	defer cancel()
+	var logs []string
+	for log := range logCh {
+		logs = append(logs, log.Text)
+	}
+	require.Equal(t, []string{"hello", "hello"}, logs)
+
+	require.NoError(t, worker.StopJob(job.ID, StopOptions{}))
+	require.ErrorIs(t, worker.StopJob("unknown", StopOptions{}), ErrorJobNotFound)
+}
+
+// blockingStore is a JobStore whose Put blocks until it is released.
+type blockingStore struct {
+	*MemoryStore
+	puts    chan JobRecord
+	release chan struct{}
+}
+
+func (s *blockingStore) Put(record JobRecord) error {
+	s.puts <- record
+	<-s.release
+	return s.MemoryStore.Put(record)
+}
+
+func TestWorker_jobStoreUnlocked(t *testing.T) {
+	store := &blockingStore{MemoryStore: NewMemoryStore(), puts: make(chan JobRecord, 10), release: make(chan struct{}, 1)}
+	worker := NewWorker(t.TempDir(), WithJobStore(store))
+	// The queued job is recorded before it starts
+	store.release <- struct{}{}
+	go func() {
+		_, _ = worker.StartJob(echoLoop(1, 0, "hello"), Metadata{})
+	}()
+	queued := <-store.puts
+	require.Equal(t, JobStateQueued, queued.Status.State)
+
+	// Jobs can be queried while their records are written, which are the
+	// records at the time of the event
+	starting := <-store.puts
+	require.Equal(t, JobStateStarting, starting.Status.State)
+	require.NotZero(t, starting.Pid)
+	status, err := worker.QueryJob(queued.ID)
+	require.NoError(t, err)
+	require.Equal(t, JobStateStarting, status.State)
+
+	close(store.release)
+	job, ok := worker.liveJob(queued.ID)
+	require.True(t, ok)
+	job.Wait()
+}
+
+func TestWorker_ShutdownStarting(t *testing.T) {
+	store := &blockingStore{MemoryStore: NewMemoryStore(), puts: make(chan JobRecord, 10), release: make(chan struct{}, 1)}
+	worker := NewWorker(t.TempDir(), WithJobStore(store))
+	store.release <- struct{}{}
+	go func() {
+		_, _ = worker.StartJob(echoLoop(100, 0.1, "hello"), Metadata{})
+	}()
+	queued := <-store.puts
+	// The job is starting while the record of its init process is written
+	starting := <-store.puts
+	require.Equal(t, JobStateStarting, starting.Status.State)
+
+	// Shutdown waits for the job to start and then stops it
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- worker.Shutdown(StopOptions{}) }()
+	select {
+	case <-shutdown:
+		t.Fatal("shutdown returned while the job was starting")
+	case <-time.After(200 * time.Millisecond):
+	}
+	close(store.release)
+	require.NoError(t, <-shutdown)
+
+	status, err := worker.QueryJob(queued.ID)
+	require.NoError(t, err)
+	require.Equal(t, JobStateStopped, status.State)
+}
+
+func TestWorker_FollowLogsCancel(t *testing.T) {
+	logDir := t.TempDir()
+	store := NewMemoryStore()
+	running := NewWorker(logDir, WithJobStore(store))
+	job, err := running.StartJob(echoLoop(1000, 0, "hello"), Metadata{})
+	require.NoError(t, err)
+	defer running.Shutdown(StopOptions{})
+	waitForLog(t, job, "hello")
+
+	// Following stops when canceled mid-stream, for jobs of the worker and of
+	// previous workers
+	for name, worker := range map[string]*Worker{"live": running, "previous": NewWorker(logDir, WithJobStore(store))} {
+		t.Run(name, func(t *testing.T) {
+			logCh, cancel, err := worker.FollowLogs(job.ID, LogStreamAll)
+			require.NoError(t, err)
+			require.Equal(t, "hello", (<-logCh).Text)
+			cancel()
+			require.Eventually(t, func() bool {
+				select {
+				case _, ok := <-logCh:
+					return !ok
+				default:
+					return false
+				}
+			}, 5*time.Second, 10*time.Millisecond)
+		})
+	}
+}
@@ -2,7 +2,7 @@
 // versions:
 // - protoc-gen-go-grpc v1.2.0
 // - protoc             (unknown)
-// source: server/v1/server.proto
+// source: service/v1/service.proto
 
 package servicepb
 
@@ -18,14 +18,19 @@ import (
 // Requires gRPC-Go v1.32.0 or later.
 const _ = grpc.SupportPackageIsVersion7
 
-// ServiceClient is the client API for Service server.
+// ServiceClient is the client API for Service service.
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type ServiceClient interface {
 	Start(ctx context.Context, in *StartRequest, opts ...grpc.CallOption) (*StartResponse, error)
 	Stop(ctx context.Context, in *StopRequest, opts ...grpc.CallOption) (*StopResponse, error)
+	StopJobs(ctx context.Context, in *StopJobsRequest, opts ...grpc.CallOption) (*StopJobsResponse, error)
 	Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (*QueryResponse, error)
 	FollowLogs(ctx context.Context, in *FollowLogsRequest, opts ...grpc.CallOption) (Service_FollowLogsClient, error)
+	ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error)
+	// Deletes a completed job and its logs.
+	DeleteJob(ctx context.Context, in *DeleteJobRequest, opts ...grpc.CallOption) (*DeleteJobResponse, error)
+	GetPermissions(ctx context.Context, in *GetPermissionsRequest, opts ...grpc.CallOption) (*GetPermissionsResponse, error)
 }
 
 type serviceClient struct {
@@ -38,7 +43,7 @@ func NewServiceClient(cc grpc.ClientConnInterface) ServiceClient {
 
 func (c *serviceClient) Start(ctx context.Context, in *StartRequest, opts ...grpc.CallOption) (*StartResponse, error) {
 	out := new(StartResponse)
-	err := c.cc.Invoke(ctx, "/server.v1.Service/Start", in, out, opts...)
+	err := c.cc.Invoke(ctx, "/service.v1.Service/Start", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -47,7 +52,16 @@ func (c *serviceClient) Start(ctx context.Context, in *StartRequest, opts ...grp
 
 func (c *serviceClient) Stop(ctx context.Context, in *StopRequest, opts ...grpc.CallOption) (*StopResponse, error) {
 	out := new(StopResponse)
-	err := c.cc.Invoke(ctx, "/server.v1.Service/Stop", in, out, opts...)
+	err := c.cc.Invoke(ctx, "/service.v1.Service/Stop", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *serviceClient) StopJobs(ctx context.Context, in *StopJobsRequest, opts ...grpc.CallOption) (*StopJobsResponse, error) {
+	out := new(StopJobsResponse)
+	err := c.cc.Invoke(ctx, "/service.v1.Service/StopJobs", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -56,7 +70,7 @@ func (c *serviceClient) Stop(ctx context.Context, in *StopRequest, opts ...grpc.
 
 func (c *serviceClient) Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (*QueryResponse, error) {
 	out := new(QueryResponse)
-	err := c.cc.Invoke(ctx, "/server.v1.Service/Query", in, out, opts...)
+	err := c.cc.Invoke(ctx, "/service.v1.Service/Query", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -64,7 +78,7 @@ func (c *serviceClient) Query(ctx context.Context, in *QueryRequest, opts ...grp
 }
 
 func (c *serviceClient) FollowLogs(ctx context.Context, in *FollowLogsRequest, opts ...grpc.CallOption) (Service_FollowLogsClient, error) {
-	stream, err := c.cc.NewStream(ctx, &Service_ServiceDesc.Streams[0], "/server.v1.Service/FollowLogs", opts...)
+	stream, err := c.cc.NewStream(ctx, &Service_ServiceDesc.Streams[0], "/service.v1.Service/FollowLogs", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -95,14 +109,46 @@ func (x *serviceFollowLogsClient) Recv() (*FollowLogsResponse, error) {
 	return m, nil
 }
 
-// ServiceServer is the server API for Service server.
+func (c *serviceClient) ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error) {
+	out := new(ListJobsResponse)
+	err := c.cc.Invoke(ctx, "/service.v1.Service/ListJobs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *serviceClient) DeleteJob(ctx context.Context, in *DeleteJobRequest, opts ...grpc.CallOption) (*DeleteJobResponse, error) {
+	out := new(DeleteJobResponse)
+	err := c.cc.Invoke(ctx, "/service.v1.Service/DeleteJob", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *serviceClient) GetPermissions(ctx context.Context, in *GetPermissionsRequest, opts ...grpc.CallOption) (*GetPermissionsResponse, error) {
+	out := new(GetPermissionsResponse)
+	err := c.cc.Invoke(ctx, "/service.v1.Service/GetPermissions", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ServiceServer is the server API for Service service.
 // All implementations should embed UnimplementedServiceServer
 // for forward compatibility
 type ServiceServer interface {
 	Start(context.Context, *StartRequest) (*StartResponse, error)
 	Stop(context.Context, *StopRequest) (*StopResponse, error)
+	StopJobs(context.Context, *StopJobsRequest) (*StopJobsResponse, error)
 	Query(context.Context, *QueryRequest) (*QueryResponse, error)
 	FollowLogs(*FollowLogsRequest, Service_FollowLogsServer) error
+	ListJobs(context.Context, *ListJobsRequest) (*ListJobsResponse, error)
+	// Deletes a completed job and its logs.
+	DeleteJob(context.Context, *DeleteJobRequest) (*DeleteJobResponse, error)
+	GetPermissions(context.Context, *GetPermissionsRequest) (*GetPermissionsResponse, error)
 }
 
 // UnimplementedServiceServer should be embedded to have forward compatible implementations.
@@ -115,14 +161,26 @@ func (UnimplementedServiceServer) Start(context.Context, *StartRequest) (*StartR
 func (UnimplementedServiceServer) Stop(context.Context, *StopRequest) (*StopResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Stop not implemented")
 }
+func (UnimplementedServiceServer) StopJobs(context.Context, *StopJobsRequest) (*StopJobsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StopJobs not implemented")
+}
 func (UnimplementedServiceServer) Query(context.Context, *QueryRequest) (*QueryResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Query not implemented")
 }
 func (UnimplementedServiceServer) FollowLogs(*FollowLogsRequest, Service_FollowLogsServer) error {
 	return status.Errorf(codes.Unimplemented, "method FollowLogs not implemented")
 }
+func (UnimplementedServiceServer) ListJobs(context.Context, *ListJobsRequest) (*ListJobsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListJobs not implemented")
+}
+func (UnimplementedServiceServer) DeleteJob(context.Context, *DeleteJobRequest) (*DeleteJobResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteJob not implemented")
+}
+func (UnimplementedServiceServer) GetPermissions(context.Context, *GetPermissionsRequest) (*GetPermissionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPermissions not implemented")
+}
 
-// UnsafeServiceServer may be embedded to opt out of forward compatibility for this server.
+// UnsafeServiceServer may be embedded to opt out of forward compatibility for this service.
 // Use of this interface is not recommended, as added methods to ServiceServer will
 // result in compilation errors.
 type UnsafeServiceServer interface {
@@ -143,7 +201,7 @@ func _Service_Start_Handler(srv interface{}, ctx context.Context, dec func(inter
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/server.v1.Service/Start",
+		FullMethod: "/service.v1.Service/Start",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
 		return srv.(ServiceServer).Start(ctx, req.(*StartRequest))
@@ -161,7 +219,7 @@ func _Service_Stop_Handler(srv interface{}, ctx context.Context, dec func(interf
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/server.v1.Service/Stop",
+		FullMethod: "/service.v1.Service/Stop",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
 		return srv.(ServiceServer).Stop(ctx, req.(*StopRequest))
@@ -169,6 +227,24 @@ func _Service_Stop_Handler(srv interface{}, ctx context.Context, dec func(interf
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Service_StopJobs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StopJobsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ServiceServer).StopJobs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/service.v1.Service/StopJobs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ServiceServer).StopJobs(ctx, req.(*StopJobsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Service_Query_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(QueryRequest)
 	if err := dec(in); err != nil {
@@ -179,7 +255,7 @@ func _Service_Query_Handler(srv interface{}, ctx context.Context, dec func(inter
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/server.v1.Service/Query",
+		FullMethod: "/service.v1.Service/Query",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
 		return srv.(ServiceServer).Query(ctx, req.(*QueryRequest))
@@ -208,11 +284,65 @@ func (x *serviceFollowLogsServer) Send(m *FollowLogsResponse) error {
 	return x.ServerStream.SendMsg(m)
 }
 
-// Service_ServiceDesc is the grpc.ServiceDesc for Service server.
+func _Service_ListJobs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListJobsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ServiceServer).ListJobs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/service.v1.Service/ListJobs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ServiceServer).ListJobs(ctx, req.(*ListJobsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Service_DeleteJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ServiceServer).DeleteJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/service.v1.Service/DeleteJob",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ServiceServer).DeleteJob(ctx, req.(*DeleteJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Service_GetPermissions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPermissionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ServiceServer).GetPermissions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/service.v1.Service/GetPermissions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ServiceServer).GetPermissions(ctx, req.(*GetPermissionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Service_ServiceDesc is the grpc.ServiceDesc for Service service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
 var Service_ServiceDesc = grpc.ServiceDesc{
-	ServiceName: "server.v1.Service",
+	ServiceName: "service.v1.Service",
 	HandlerType: (*ServiceServer)(nil),
 	Methods: []grpc.MethodDesc{
 		{
@@ -223,10 +353,26 @@ var Service_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Stop",
 			Handler:    _Service_Stop_Handler,
 		},
+		{
+			MethodName: "StopJobs",
+			Handler:    _Service_StopJobs_Handler,
+		},
 		{
 			MethodName: "Query",
 			Handler:    _Service_Query_Handler,
 		},
+		{
+			MethodName: "ListJobs",
+			Handler:    _Service_ListJobs_Handler,
+		},
+		{
+			MethodName: "DeleteJob",
+			Handler:    _Service_DeleteJob_Handler,
+		},
+		{
+			MethodName: "GetPermissions",
+			Handler:    _Service_GetPermissions_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -235,5 +381,5 @@ var Service_ServiceDesc = grpc.ServiceDesc{
 			ServerStreams: true,
 		},
 	},
-	Metadata: "server/v1/server.proto",
+	Metadata: "service/v1/service.proto",
 }